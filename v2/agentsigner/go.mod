@@ -0,0 +1,17 @@
+module github.com/pagerguild/ghinstallation/v2/agentsigner
+
+go 1.23.2
+
+require (
+	github.com/golang-jwt/jwt/v5 v5.2.1
+	github.com/pagerguild/ghinstallation/v2 v2.0.0-00010101000000-000000000000
+	golang.org/x/crypto v0.41.0
+)
+
+require (
+	github.com/google/go-github/v69 v69.0.0 // indirect
+	github.com/google/go-querystring v1.1.0 // indirect
+	golang.org/x/sys v0.35.0 // indirect
+)
+
+replace github.com/pagerguild/ghinstallation/v2 => ../
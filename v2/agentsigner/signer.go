@@ -0,0 +1,133 @@
+// Package agentsigner provides a crypto.Signer backed by an RSA key loaded
+// in an ssh-agent, for use with ghinstallation.NewAppsTransportFromSigner.
+//
+// This allows developers to authenticate as a GitHub App locally without
+// the private key being written to disk.
+package agentsigner
+
+import (
+	"crypto"
+	"crypto/rsa"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"os"
+
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/agent"
+)
+
+// Signer is a crypto.Signer which signs using an RSA key in an ssh-agent.
+//
+// An ssh-agent hashes the message itself, so Signer only supports signing
+// via SignMessage, which ghinstallation.AppsTransport uses when available.
+type Signer struct {
+	agent agent.ExtendedAgent
+	key   ssh.PublicKey
+	pub   *rsa.PublicKey
+	conn  net.Conn // conn is the connection to the agent, if dialed by NewFromEnv
+}
+
+// New returns a Signer using the RSA key in a selected by fingerprint or
+// comment. The fingerprint may be in SHA256 or legacy MD5 format, as printed
+// by ssh-add -l. If both are empty, the agent must hold exactly one RSA key.
+func New(a agent.ExtendedAgent, fingerprint, comment string) (*Signer, error) {
+	keys, err := a.List()
+	if err != nil {
+		return nil, fmt.Errorf("agentsigner: could not list keys: %w", err)
+	}
+
+	var matched []*agent.Key
+	for _, k := range keys {
+		if k.Type() != ssh.KeyAlgoRSA {
+			continue
+		}
+		if fingerprint != "" && fingerprint != ssh.FingerprintSHA256(k) && fingerprint != ssh.FingerprintLegacyMD5(k) {
+			continue
+		}
+		if comment != "" && comment != k.Comment {
+			continue
+		}
+		matched = append(matched, k)
+	}
+	switch {
+	case len(matched) == 0:
+		return nil, fmt.Errorf("agentsigner: no RSA key found with fingerprint %q and comment %q", fingerprint, comment)
+	case len(matched) > 1:
+		return nil, fmt.Errorf("agentsigner: %d RSA keys found with fingerprint %q and comment %q", len(matched), fingerprint, comment)
+	}
+
+	key, err := ssh.ParsePublicKey(matched[0].Marshal())
+	if err != nil {
+		return nil, fmt.Errorf("agentsigner: could not parse public key: %w", err)
+	}
+	cpk, ok := key.(ssh.CryptoPublicKey)
+	if !ok {
+		return nil, fmt.Errorf("agentsigner: unsupported public key %T", key)
+	}
+	pub, ok := cpk.CryptoPublicKey().(*rsa.PublicKey)
+	if !ok {
+		return nil, fmt.Errorf("agentsigner: key is %T, want *rsa.PublicKey", cpk.CryptoPublicKey())
+	}
+	return &Signer{agent: a, key: key, pub: pub}, nil
+}
+
+// NewFromEnv connects to the ssh-agent listening on SSH_AUTH_SOCK and returns
+// a Signer as New. The returned Signer should be closed when no longer
+// required.
+func NewFromEnv(fingerprint, comment string) (*Signer, error) {
+	sock := os.Getenv("SSH_AUTH_SOCK")
+	if sock == "" {
+		return nil, errors.New("agentsigner: SSH_AUTH_SOCK is not set")
+	}
+	conn, err := net.Dial("unix", sock)
+	if err != nil {
+		return nil, fmt.Errorf("agentsigner: could not connect to ssh-agent: %w", err)
+	}
+	s, err := New(agent.NewClient(conn), fingerprint, comment)
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+	s.conn = conn
+	return s, nil
+}
+
+// Public implements crypto.Signer.
+func (s *Signer) Public() crypto.PublicKey {
+	return s.pub
+}
+
+// Sign implements crypto.Signer, but always returns an error as an ssh-agent
+// cannot sign a digest, use SignMessage instead.
+func (s *Signer) Sign(io.Reader, []byte, crypto.SignerOpts) ([]byte, error) {
+	return nil, errors.New("agentsigner: ssh-agent cannot sign a digest, use SignMessage")
+}
+
+// SignMessage signs msg with the rsa-sha2-256 algorithm, producing a PKCS #1
+// v1.5 signature of the SHA-256 hash of msg, as required for RS256 JWTs.
+func (s *Signer) SignMessage(_ io.Reader, msg []byte, opts crypto.SignerOpts) ([]byte, error) {
+	if opts.HashFunc() != crypto.SHA256 {
+		return nil, fmt.Errorf("agentsigner: unsupported hash function %v", opts.HashFunc())
+	}
+	if _, ok := opts.(*rsa.PSSOptions); ok {
+		return nil, errors.New("agentsigner: RSA-PSS signatures are not supported")
+	}
+	sig, err := s.agent.SignWithFlags(s.key, msg, agent.SignatureFlagRsaSha256)
+	if err != nil {
+		return nil, fmt.Errorf("agentsigner: could not sign: %w", err)
+	}
+	if sig.Format != ssh.KeyAlgoRSASHA256 {
+		return nil, fmt.Errorf("agentsigner: agent returned %q signature, want %q", sig.Format, ssh.KeyAlgoRSASHA256)
+	}
+	return sig.Blob, nil
+}
+
+// Close closes the connection to the ssh-agent if it was opened by NewFromEnv.
+func (s *Signer) Close() error {
+	if s.conn == nil {
+		return nil
+	}
+	return s.conn.Close()
+}
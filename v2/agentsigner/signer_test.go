@@ -0,0 +1,161 @@
+package agentsigner
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/pagerguild/ghinstallation/v2"
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/agent"
+)
+
+// newKeyring returns an in-process agent holding two RSA keys and an ECDSA key.
+func newKeyring(t *testing.T) (agent.ExtendedAgent, []*rsa.PrivateKey) {
+	keyring := agent.NewKeyring().(agent.ExtendedAgent)
+	var keys []*rsa.PrivateKey
+	for _, comment := range []string{"github-app", "other"} {
+		key, err := rsa.GenerateKey(rand.Reader, 2048)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := keyring.Add(agent.AddedKey{PrivateKey: key, Comment: comment}); err != nil {
+			t.Fatal(err)
+		}
+		keys = append(keys, key)
+	}
+	ecKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := keyring.Add(agent.AddedKey{PrivateKey: ecKey, Comment: "ecdsa"}); err != nil {
+		t.Fatal(err)
+	}
+	return keyring, keys
+}
+
+func TestNew_selection(t *testing.T) {
+	keyring, keys := newKeyring(t)
+	sshPub, err := ssh.NewPublicKey(&keys[1].PublicKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name        string
+		fingerprint string
+		comment     string
+		want        *rsa.PrivateKey
+	}{
+		{name: "comment", comment: "github-app", want: keys[0]},
+		{name: "sha256 fingerprint", fingerprint: ssh.FingerprintSHA256(sshPub), want: keys[1]},
+		{name: "md5 fingerprint", fingerprint: ssh.FingerprintLegacyMD5(sshPub), want: keys[1]},
+		{name: "fingerprint and comment", fingerprint: ssh.FingerprintSHA256(sshPub), comment: "other", want: keys[1]},
+		{name: "mismatched fingerprint and comment", fingerprint: ssh.FingerprintSHA256(sshPub), comment: "github-app"},
+		{name: "ambiguous"},
+		{name: "not RSA", comment: "ecdsa"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s, err := New(keyring, tt.fingerprint, tt.comment)
+			if tt.want == nil {
+				if err == nil {
+					t.Fatal("expected error")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !tt.want.PublicKey.Equal(s.Public()) {
+				t.Error("selected wrong key")
+			}
+		})
+	}
+}
+
+func TestSignMessage(t *testing.T) {
+	keyring, keys := newKeyring(t)
+	s, err := New(keyring, "", "github-app")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	msg := []byte("message")
+	sig, err := s.SignMessage(nil, msg, crypto.SHA256)
+	if err != nil {
+		t.Fatal(err)
+	}
+	digest := sha256.Sum256(msg)
+	if err := rsa.VerifyPKCS1v15(&keys[0].PublicKey, crypto.SHA256, digest[:], sig); err != nil {
+		t.Fatalf("VerifyPKCS1v15: %v", err)
+	}
+
+	if _, err := s.Sign(nil, digest[:], crypto.SHA256); err == nil {
+		t.Fatal("expected error signing a digest")
+	}
+}
+
+func TestNewFromEnv(t *testing.T) {
+	keyring, keys := newKeyring(t)
+
+	sock := filepath.Join(t.TempDir(), "agent.sock")
+	l, err := net.Listen("unix", sock)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+	go func() {
+		for {
+			conn, err := l.Accept()
+			if err != nil {
+				return
+			}
+			go agent.ServeAgent(keyring, conn)
+		}
+	}()
+	t.Setenv("SSH_AUTH_SOCK", sock)
+
+	s, err := NewFromEnv("", "github-app")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+
+	check := roundTripFunc(func(req *http.Request) (*http.Response, error) {
+		token := strings.Fields(req.Header.Get("Authorization"))[1]
+		_, err := jwt.NewParser(jwt.WithValidMethods([]string{"RS256"})).Parse(token, func(*jwt.Token) (interface{}, error) {
+			return keys[0].Public(), nil
+		})
+		if err != nil {
+			t.Errorf("jwt parse: %v", err)
+		}
+		return nil, nil
+	})
+
+	tr, err := ghinstallation.NewAppsTransportFromSigner(check, "Iv1.0123456789abcdef", s)
+	if err != nil {
+		t.Fatal(err)
+	}
+	req := httptest.NewRequest(http.MethodGet, "http://example.com", new(bytes.Buffer))
+	if _, err := tr.RoundTrip(req); err != nil {
+		t.Fatalf("error calling RoundTrip: %v", err)
+	}
+}
+
+type roundTripFunc func(*http.Request) (*http.Response, error)
+
+func (f roundTripFunc) RoundTrip(req *http.Request) (*http.Response, error) {
+	return f(req)
+}
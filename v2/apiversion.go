@@ -0,0 +1,52 @@
+package ghinstallation
+
+import (
+	"context"
+	"net/http"
+)
+
+// apiVersionHeader is the header selecting the version of GitHub's REST API.
+const apiVersionHeader = "X-GitHub-Api-Version"
+
+type contextKey int
+
+const (
+	apiVersionKey contextKey = iota
+	mediaTypeKey
+)
+
+// WithAPIVersion returns a copy of ctx which overrides the REST API version
+// sent in the X-GitHub-Api-Version header of requests made with it,
+// including any version set on the request or the transport.
+func WithAPIVersion(ctx context.Context, version string) context.Context {
+	return context.WithValue(ctx, apiVersionKey, version)
+}
+
+// WithMediaType returns a copy of ctx which overrides the media type sent in
+// the Accept header of requests made with it, including any media type set
+// on the request, such as by github.Client.
+func WithMediaType(ctx context.Context, mediaType string) context.Context {
+	return context.WithValue(ctx, mediaTypeKey, mediaType)
+}
+
+// setAPIHeaders sets the Accept and X-GitHub-Api-Version headers of req,
+// which must be a copy of the caller's request. Overrides in req's context
+// take precedence, then headers set by the caller, then mediaType and
+// version, which default to application/vnd.github.v3+json and no version.
+func setAPIHeaders(req *http.Request, mediaType, version string) {
+	ctx := req.Context()
+	if v, ok := ctx.Value(mediaTypeKey).(string); ok && v != "" {
+		req.Header.Set("Accept", v)
+	} else if req.Header.Get("Accept") == "" {
+		if mediaType == "" {
+			mediaType = acceptHeader
+		}
+		req.Header.Set("Accept", mediaType)
+	}
+
+	if v, ok := ctx.Value(apiVersionKey).(string); ok && v != "" {
+		req.Header.Set(apiVersionHeader, v)
+	} else if req.Header.Get(apiVersionHeader) == "" && version != "" {
+		req.Header.Set(apiVersionHeader, version)
+	}
+}
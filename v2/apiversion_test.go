@@ -0,0 +1,70 @@
+package ghinstallation
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestSetAPIHeaders(t *testing.T) {
+	tests := []struct {
+		name        string
+		ctx         context.Context
+		header      http.Header
+		mediaType   string
+		version     string
+		wantAccept  string
+		wantVersion string
+	}{
+		{"defaults", context.Background(), nil, "", "", acceptHeader, ""},
+		{"transport", context.Background(), nil, "application/vnd.github+json", "2022-11-28", "application/vnd.github+json", "2022-11-28"},
+		{"caller", context.Background(), http.Header{"Accept": {"application/vnd.github.raw"}, apiVersionHeader: {"2026-03-10"}}, "application/vnd.github+json", "2022-11-28", "application/vnd.github.raw", "2026-03-10"},
+		{"context", WithAPIVersion(WithMediaType(context.Background(), "application/vnd.github.diff"), "2026-03-10"), http.Header{"Accept": {"application/vnd.github.raw"}, apiVersionHeader: {"2022-11-28"}}, "", "2022-11-28", "application/vnd.github.diff", "2026-03-10"},
+		{"empty context", WithAPIVersion(WithMediaType(context.Background(), ""), ""), nil, "", "2022-11-28", acceptHeader, "2022-11-28"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "https://api.github.com/repos/o/r", nil).WithContext(tt.ctx)
+			for k, v := range tt.header {
+				req.Header.Set(k, v[0])
+			}
+			setAPIHeaders(req, tt.mediaType, tt.version)
+			if got := req.Header.Values("Accept"); len(got) != 1 || got[0] != tt.wantAccept {
+				t.Errorf("Accept = %q, want %q", got, tt.wantAccept)
+			}
+			if got := req.Header.Get(apiVersionHeader); got != tt.wantVersion {
+				t.Errorf("%s = %q, want %q", apiVersionHeader, got, tt.wantVersion)
+			}
+		})
+	}
+}
+
+func TestTransport_APIVersion(t *testing.T) {
+	var got []*http.Request
+	rt := &RoundTrip{rt: func(req *http.Request) (*http.Response, error) {
+		got = append(got, req)
+		return &http.Response{StatusCode: http.StatusOK, Body: http.NoBody}, nil
+	}}
+	atr, err := NewAppsTransport(rt, appID, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	atr.APIVersion = "2022-11-28"
+	tr := NewFromAppsTransport(atr, installationID)
+	tr.token = &accessToken{Token: token, ExpiresAt: time.Now().Add(time.Hour)}
+
+	req := httptest.NewRequest(http.MethodGet, "https://api.github.com/repos/o/r", nil)
+	if _, err := tr.RoundTrip(req); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := tr.RoundTrip(req.WithContext(WithAPIVersion(req.Context(), "2026-03-10"))); err != nil {
+		t.Fatal(err)
+	}
+	for i, want := range []string{"2022-11-28", "2026-03-10"} {
+		if v := got[i].Header.Get(apiVersionHeader); v != want {
+			t.Errorf("request %d: %s = %q, want %q", i, apiVersionHeader, v, want)
+		}
+	}
+}
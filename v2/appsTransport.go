@@ -1,10 +1,16 @@
 package ghinstallation
 
 import (
+	"context"
+	"crypto"
+	"crypto/rand"
 	"crypto/rsa"
+	"crypto/sha256"
+	"errors"
 	"fmt"
+	"io"
 	"net/http"
-	"os"
+	"sync"
 	"time"
 
 	"github.com/golang-jwt/jwt/v5"
@@ -14,55 +20,187 @@ import (
 // http.RoundTripper and provides GitHub Apps authentication as a
 // GitHub App.
 //
-// Client can also be overwritten, and is useful to change to one which
-// provides retry logic if you do experience retryable errors.
-//
 // See https://developer.github.com/apps/building-integrations/setting-up-and-registering-github-apps/about-authentication-options-for-github-apps/
 type AppsTransport struct {
-	BaseURL  string            // BaseURL is the scheme and host for GitHub API, defaults to https://api.github.com
-	Client   Client            // Client to use to refresh tokens, defaults to http.Client with provided transport
-	tr       http.RoundTripper // tr is the underlying roundtripper being wrapped
-	key      *rsa.PrivateKey   // key is the GitHub App's private key
-	clientID string            // appID is the GitHub App's ID
+	BaseURL    string            // BaseURL is the scheme and host for GitHub API, defaults to https://api.github.com
+	JWTHook    JWTHook           // JWTHook customizes the JWT's headers and claims before signing, optional
+	MediaType  string            // MediaType is the Accept header sent when the request has none, defaults to application/vnd.github.v3+json
+	APIVersion string            // APIVersion is the X-GitHub-Api-Version header sent when the request has none, optional
+	tr         http.RoundTripper // tr is the underlying roundtripper being wrapped
+	app        AppIdentity       // app is the GitHub App's ID or client ID
+
+	// Deprecated: Client is not used by AppsTransport, which sends requests
+	// with the wrapped http.RoundTripper. Set Transport.Client to change the
+	// client used to refresh installation tokens.
+	Client Client
+
+	keyMu      sync.RWMutex  // keyMu protects signer and prevSigner
+	signer     crypto.Signer // signer signs the JWT with the GitHub App's private key
+	prevSigner crypto.Signer // prevSigner is the signer replaced by the last key rotation, if any
+	keySource  KeySource     // keySource provides the private key when signer is nil, and on refresh
 }
 
 // NewAppsTransportKeyFromFile returns a AppsTransport using a private key from file.
-func NewAppsTransportKeyFromFile(tr http.RoundTripper, clientID string, privateKeyFile string) (*AppsTransport, error) {
-	privateKey, err := os.ReadFile(privateKeyFile)
+// clientID is the GitHub App's client ID or numeric app ID, see AppIdentity.
+//
+// The file must not be readable by group or others, must contain only an RSA
+// key of at least 2048 bits, without other PEM headers or text, unless
+// overridden by opts, see KeyFileOption.
+func NewAppsTransportKeyFromFile(tr http.RoundTripper, clientID string, privateKeyFile string, opts ...KeyFileOption) (*AppsTransport, error) {
+	app := AppIdentity(clientID)
+	if err := app.Validate(); err != nil {
+		return nil, err
+	}
+	key, err := loadKeyFile(privateKeyFile, opts)
 	if err != nil {
-		return nil, fmt.Errorf("could not read private key: %s", err)
+		return nil, err
 	}
-	return NewAppsTransport(tr, clientID, privateKey)
+	return newAppsTransport(tr, app, key), nil
 }
 
 // NewAppsTransport returns a AppsTransport using private key. The key is parsed
-// and if any errors occur the error is non-nil.
+// and if any errors occur the error is non-nil. clientID is the GitHub App's
+// client ID or numeric app ID, see AppIdentity. See ParsePrivateKey for the
+// supported key formats, encrypted keys must be parsed with ParsePrivateKey
+// and passed to NewAppsTransportFromPrivateKey.
 //
 // The provided tr http.RoundTripper should be shared between multiple
 // installations to ensure reuse of underlying TCP connections.
 //
 // The returned Transport's RoundTrip method is safe to be used concurrently.
 func NewAppsTransport(tr http.RoundTripper, clientID string, privateKey []byte) (*AppsTransport, error) {
-	key, err := jwt.ParseRSAPrivateKeyFromPEM(privateKey)
+	return newAppsTransportFromKey(tr, AppIdentity(clientID), privateKey)
+}
+
+// newAppsTransportFromKey returns an AppsTransport for app using the PEM
+// encoded privateKey, see NewAppsTransport.
+func newAppsTransportFromKey(tr http.RoundTripper, app AppIdentity, privateKey []byte) (*AppsTransport, error) {
+	if err := app.Validate(); err != nil {
+		return nil, err
+	}
+	key, err := ParsePrivateKey(privateKey, nil)
 	if err != nil {
-		return nil, fmt.Errorf("could not parse private key: %s", err)
+		return nil, fmt.Errorf("could not parse private key: %w", err)
 	}
-	return NewAppsTransportFromPrivateKey(tr, clientID, key), nil
+	return newAppsTransport(tr, app, key), nil
 }
 
 // NewAppsTransportFromPrivateKey returns an AppsTransport using a crypto/rsa.(*PrivateKey).
+// clientID is the GitHub App's client ID or numeric app ID, see AppIdentity.
+//
+// If clientID is invalid, the returned AppsTransport's RoundTrip method
+// returns an error, use AppIdentity.Validate to check it beforehand.
 func NewAppsTransportFromPrivateKey(tr http.RoundTripper, clientID string, key *rsa.PrivateKey) *AppsTransport {
+	return newAppsTransport(tr, AppIdentity(clientID), key)
+}
+
+// NewAppsTransportFromSigner returns an AppsTransport which signs its JWTs
+// using signer, allowing the private key to be held outside of the process,
+// such as in an HSM or a cloud KMS.
+//
+// The signer's public key must be an RSA key, as GitHub requires RS256 JWTs.
+// Signers which hash the message themselves, such as an ssh-agent, may
+// implement the SignMessage method of crypto.MessageSigner, which will be
+// used instead of Sign.
+func NewAppsTransportFromSigner(tr http.RoundTripper, app AppIdentity, signer crypto.Signer) (*AppsTransport, error) {
+	if err := app.Validate(); err != nil {
+		return nil, err
+	}
+	if _, ok := signer.Public().(*rsa.PublicKey); !ok {
+		return nil, fmt.Errorf("signer public key must be *rsa.PublicKey, got %T", signer.Public())
+	}
+	return newAppsTransport(tr, app, signer), nil
+}
+
+func newAppsTransport(tr http.RoundTripper, app AppIdentity, signer crypto.Signer) *AppsTransport {
 	return &AppsTransport{
-		BaseURL:  apiBaseURL,
-		Client:   &http.Client{Transport: tr},
-		tr:       tr,
-		key:      key,
-		clientID: clientID,
+		BaseURL: apiBaseURL,
+		Client:  &http.Client{Transport: tr},
+		tr:      tr,
+		signer:  signer,
+		app:     app,
 	}
 }
 
 // RoundTrip implements http.RoundTripper interface.
+//
+// If the key has been rotated and GitHub rejects the JWT, the request is
+// retried once with the previous key, provided its body can be replayed.
 func (t *AppsTransport) RoundTrip(req *http.Request) (resp *http.Response, err error) {
+	return t.send(req, t.tr.RoundTrip)
+}
+
+// send authenticates req with a JWT and sends it with do, so the JWT can be
+// applied to requests sent by other clients such as Transport.Client.
+func (t *AppsTransport) send(req *http.Request, do func(*http.Request) (*http.Response, error)) (resp *http.Response, err error) {
+	signer, prevSigner, err := t.signers(req.Context())
+	if err != nil {
+		closeRequestBody(req)
+		return nil, err
+	}
+
+	ss, err := t.signJWT(req.Context(), signer)
+	if err != nil {
+		closeRequestBody(req)
+		return nil, err
+	}
+
+	// A RoundTripper must not modify the caller's request, so add headers
+	// to a copy.
+	req = req.Clone(req.Context())
+	req.Header.Set("Authorization", "Bearer "+ss)
+	setAPIHeaders(req, t.MediaType, t.APIVersion)
+
+	resp, err = do(req)
+	if err != nil || prevSigner == nil || resp == nil || resp.StatusCode != http.StatusUnauthorized {
+		return resp, err
+	}
+
+	// The new key may not be registered with GitHub yet, so fall back to
+	// the previous key during the rotation window.
+	retry, ok := replayableRequest(req)
+	if !ok {
+		return resp, err
+	}
+	if ss, err = t.signJWT(req.Context(), prevSigner); err != nil {
+		return resp, nil
+	}
+	retry.Header.Set("Authorization", "Bearer "+ss)
+	io.Copy(io.Discard, resp.Body)
+	resp.Body.Close()
+	return do(retry)
+}
+
+// signers returns the current and previous signers, fetching the key from
+// the KeySource if it has not been fetched yet.
+func (t *AppsTransport) signers(ctx context.Context) (signer, prevSigner crypto.Signer, err error) {
+	t.keyMu.RLock()
+	signer, prevSigner = t.signer, t.prevSigner
+	t.keyMu.RUnlock()
+	if signer != nil {
+		return signer, prevSigner, nil
+	}
+
+	t.keyMu.Lock()
+	defer t.keyMu.Unlock()
+	if t.signer == nil {
+		if t.keySource == nil {
+			return nil, nil, errors.New("AppsTransport has no key")
+		}
+		key, err := fetchKey(ctx, t.keySource)
+		if err != nil {
+			return nil, nil, err
+		}
+		t.signer = key
+	}
+	return t.signer, t.prevSigner, nil
+}
+
+// signJWT returns a JWT authenticating as the GitHub App, signed by signer.
+func (t *AppsTransport) signJWT(ctx context.Context, signer crypto.Signer) (string, error) {
+	if err := t.app.Validate(); err != nil {
+		return "", err
+	}
 	// GitHub rejects expiry and issue timestamps that are not an integer,
 	// while the jwt-go library serializes to fractional timestamps.
 	// Truncate them before passing to jwt-go.
@@ -71,18 +209,99 @@ func (t *AppsTransport) RoundTrip(req *http.Request) (resp *http.Response, err e
 	claims := &jwt.RegisteredClaims{
 		IssuedAt:  jwt.NewNumericDate(iss),
 		ExpiresAt: jwt.NewNumericDate(exp),
-		Issuer:    t.clientID,
+		Issuer:    string(t.app),
+	}
+	bearer := jwt.NewWithClaims(signingMethodRS256, claims)
+	if t.JWTHook != nil {
+		var err error
+		if bearer, err = applyJWTHook(t.JWTHook, bearer, claims); err != nil {
+			return "", err
+		}
+	}
+
+	ss, err := bearer.SignedString(&signingKey{ctx: ctx, signer: signer})
+	if err != nil {
+		return "", fmt.Errorf("could not sign jwt: %s", err)
 	}
-	bearer := jwt.NewWithClaims(jwt.SigningMethodRS256, claims)
+	return ss, nil
+}
 
-	ss, err := bearer.SignedString(t.key)
+// replayableRequest returns a copy of req which can be sent again, or false
+// if req's body cannot be replayed.
+func replayableRequest(req *http.Request) (*http.Request, bool) {
+	retry := req.Clone(req.Context())
+	if req.Body == nil || req.Body == http.NoBody {
+		return retry, true
+	}
+	if req.GetBody == nil {
+		return nil, false
+	}
+	body, err := req.GetBody()
 	if err != nil {
-		return nil, fmt.Errorf("could not sign jwt: %s", err)
+		return nil, false
 	}
+	retry.Body = body
+	return retry, true
+}
 
-	req.Header.Set("Authorization", "Bearer "+ss)
-	req.Header.Add("Accept", acceptHeader)
+// closeRequestBody closes req's body, as a RoundTripper must even when it
+// returns an error without sending req.
+func closeRequestBody(req *http.Request) {
+	if req.Body != nil {
+		req.Body.Close()
+	}
+}
+
+// ContextSigner is a crypto.Signer which can also sign using a context, such
+// as a signer which calls a remote service. When the AppsTransport's signer
+// implements ContextSigner, the request's context is used for signing.
+type ContextSigner interface {
+	crypto.Signer
+	SignContext(ctx context.Context, digest []byte, opts crypto.SignerOpts) ([]byte, error)
+}
+
+// messageSigner is implemented by signers which must be given the message
+// rather than its digest, as they hash the message themselves. It has the
+// same method as crypto.MessageSigner.
+type messageSigner interface {
+	SignMessage(rand io.Reader, msg []byte, opts crypto.SignerOpts) ([]byte, error)
+}
+
+// signingKey is the key passed to signingMethodRS256.
+type signingKey struct {
+	ctx    context.Context
+	signer crypto.Signer
+}
+
+// signingMethodRS256 produces RS256 signatures using any crypto.Signer,
+// rather than requiring an *rsa.PrivateKey like jwt.SigningMethodRS256.
+var signingMethodRS256 = &signerMethod{}
 
-	resp, err = t.tr.RoundTrip(req)
-	return resp, err
+// signerMethod implements jwt.SigningMethod for RS256 using a crypto.Signer.
+type signerMethod struct{}
+
+// Alg implements jwt.SigningMethod.
+func (m *signerMethod) Alg() string {
+	return jwt.SigningMethodRS256.Alg()
+}
+
+// Verify implements jwt.SigningMethod.
+func (m *signerMethod) Verify(signingString string, sig []byte, key interface{}) error {
+	return jwt.SigningMethodRS256.Verify(signingString, sig, key)
+}
+
+// Sign implements jwt.SigningMethod, key must be a *signingKey.
+func (m *signerMethod) Sign(signingString string, key interface{}) ([]byte, error) {
+	k, ok := key.(*signingKey)
+	if !ok {
+		return nil, fmt.Errorf("key must be *signingKey, got %T", key)
+	}
+	if ms, ok := k.signer.(messageSigner); ok {
+		return ms.SignMessage(rand.Reader, []byte(signingString), crypto.SHA256)
+	}
+	digest := sha256.Sum256([]byte(signingString))
+	if cs, ok := k.signer.(ContextSigner); ok {
+		return cs.SignContext(k.ctx, digest[:], crypto.SHA256)
+	}
+	return k.signer.Sign(rand.Reader, digest[:], crypto.SHA256)
 }
@@ -2,6 +2,10 @@ package ghinstallation
 
 import (
 	"bytes"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
 	"net/http"
 	"net/http/httptest"
 	"os"
@@ -49,7 +53,7 @@ func TestAppsTransport(t *testing.T) {
 			if !ok {
 				t.Error("Header Accept not set")
 			}
-			want := []string{customHeader, acceptHeader}
+			want := []string{customHeader}
 			if diff := cmp.Diff(want, h); diff != "" {
 				t.Errorf("HTTP Accept headers want->got: %s", diff)
 			}
@@ -105,3 +109,50 @@ func TestJWTExpiry(t *testing.T) {
 		t.Fatalf("error calling RoundTrip: %v", err)
 	}
 }
+
+// opaqueSigner hides the concrete key type, as a HSM or KMS backed signer would.
+type opaqueSigner struct {
+	crypto.Signer
+}
+
+func TestNewAppsTransportFromSigner(t *testing.T) {
+	key, err := jwt.ParseRSAPrivateKeyFromPEM(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	check := RoundTrip{
+		rt: func(req *http.Request) (*http.Response, error) {
+			token := strings.Fields(req.Header.Get("Authorization"))[1]
+			tok, err := jwt.NewParser(jwt.WithValidMethods([]string{"RS256"})).ParseWithClaims(token, &jwt.RegisteredClaims{}, func(t *jwt.Token) (interface{}, error) {
+				return key.Public(), nil
+			})
+			if err != nil {
+				t.Fatalf("jwt parse: %v", err)
+			}
+			if iss, _ := tok.Claims.GetIssuer(); iss != appID {
+				t.Errorf("iss = %q, want %q", iss, appID)
+			}
+			return nil, nil
+		},
+	}
+
+	tr, err := NewAppsTransportFromSigner(check, appID, opaqueSigner{key})
+	if err != nil {
+		t.Fatalf("error creating transport: %v", err)
+	}
+	req := httptest.NewRequest(http.MethodGet, "http://example.com", new(bytes.Buffer))
+	if _, err := tr.RoundTrip(req); err != nil {
+		t.Fatalf("error calling RoundTrip: %v", err)
+	}
+}
+
+func TestNewAppsTransportFromSigner_notRSA(t *testing.T) {
+	ecKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := NewAppsTransportFromSigner(&http.Transport{}, appID, ecKey); err == nil {
+		t.Fatal("expected error for non-RSA signer")
+	}
+}
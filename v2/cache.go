@@ -0,0 +1,222 @@
+package ghinstallation
+
+import (
+	"bytes"
+	"container/list"
+	"encoding/json"
+	"io"
+	"net/http"
+	"sync"
+)
+
+const (
+	maxCacheBody        = 1 << 20  // maxCacheBody is the largest response body stored in a Cache
+	defaultCacheEntries = 1000     // defaultCacheEntries bounds a Cache created with no size
+	defaultCacheBytes   = 64 << 20 // defaultCacheBytes bounds the memory of a Cache created with no byte budget
+)
+
+// Cache is a bounded in-memory cache of GitHub API responses, used by
+// Transport to make conditional requests. GitHub does not count 304 Not
+// Modified responses against the rate limit, so polling an unchanged
+// resource through a Cache is free.
+//
+// Entries are keyed by installation and InstallationTokenOptions, so a Cache
+// may be shared by the Transports of several installations, or of tokens with
+// different permissions, without responses leaking between tokens with
+// different access. A Cache is safe for concurrent use.
+type Cache struct {
+	mu         sync.Mutex
+	maxEntries int
+	maxBytes   int64
+	size       int64                      // size is the total size of the entries
+	ll         *list.List                 // ll orders entries from most to least recently used
+	entries    map[cacheKey]*list.Element // entries holds *cacheEntry values
+}
+
+type cacheKey struct {
+	installationID int64
+	scope          string // scope is the JSON encoded InstallationTokenOptions
+	url            string
+	accept         string
+	apiVersion     string
+}
+
+type cacheEntry struct {
+	key    cacheKey
+	header http.Header
+	body   []byte
+}
+
+// size returns the approximate memory used by e's response.
+func (e *cacheEntry) size() int64 {
+	n := len(e.body)
+	for k, vs := range e.header {
+		n += len(k)
+		for _, v := range vs {
+			n += len(v)
+		}
+	}
+	return int64(n)
+}
+
+// NewCache returns a Cache holding at most maxEntries responses, evicting the
+// least recently used. If maxEntries is not positive, the Cache holds at most
+// 1000 responses. The Cache's responses use at most 64 MiB, see NewCacheSize.
+func NewCache(maxEntries int) *Cache {
+	return NewCacheSize(maxEntries, 0)
+}
+
+// NewCacheSize returns a Cache holding at most maxEntries responses, whose
+// headers and bodies total at most maxBytes, evicting the least recently
+// used. If maxEntries is not positive, the Cache holds at most 1000
+// responses, and if maxBytes is not positive, at most 64 MiB.
+func NewCacheSize(maxEntries int, maxBytes int64) *Cache {
+	if maxEntries <= 0 {
+		maxEntries = defaultCacheEntries
+	}
+	if maxBytes <= 0 {
+		maxBytes = defaultCacheBytes
+	}
+	return &Cache{
+		maxEntries: maxEntries,
+		maxBytes:   maxBytes,
+		ll:         list.New(),
+		entries:    make(map[cacheKey]*list.Element),
+	}
+}
+
+// Len returns the number of responses in the cache.
+func (c *Cache) Len() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.ll.Len()
+}
+
+// Size returns the approximate number of bytes used by the responses in the
+// cache.
+func (c *Cache) Size() int64 {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.size
+}
+
+func (c *Cache) get(key cacheKey) (*cacheEntry, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	el, ok := c.entries[key]
+	if !ok {
+		return nil, false
+	}
+	c.ll.MoveToFront(el)
+	return el.Value.(*cacheEntry), true
+}
+
+func (c *Cache) add(e *cacheEntry) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if el, ok := c.entries[e.key]; ok {
+		c.size -= el.Value.(*cacheEntry).size()
+		el.Value = e
+		c.ll.MoveToFront(el)
+	} else {
+		c.entries[e.key] = c.ll.PushFront(e)
+	}
+	c.size += e.size()
+	for c.ll.Len() > c.maxEntries || c.size > c.maxBytes {
+		c.removeElement(c.ll.Back())
+	}
+}
+
+func (c *Cache) remove(key cacheKey) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if el, ok := c.entries[key]; ok {
+		c.removeElement(el)
+	}
+}
+
+// removeElement removes el from the cache, c.mu must be held.
+func (c *Cache) removeElement(el *list.Element) {
+	e := el.Value.(*cacheEntry)
+	c.ll.Remove(el)
+	delete(c.entries, e.key)
+	c.size -= e.size()
+}
+
+// send sends req with the underlying transport, through the Cache if set.
+// Cacheable requests are made conditional on a cached response, which is
+// returned, marked with an X-From-Cache header, if GitHub responds with 304
+// Not Modified.
+func (t *Transport) send(req *http.Request) (*http.Response, error) {
+	if t.Cache == nil || req.Method != http.MethodGet || req.Header.Get("Range") != "" ||
+		req.Header.Get("If-None-Match") != "" || req.Header.Get("If-Modified-Since") != "" {
+		return t.tr.RoundTrip(req)
+	}
+
+	scope, err := json.Marshal(t.InstallationTokenOptions)
+	if err != nil {
+		return t.tr.RoundTrip(req)
+	}
+	key := cacheKey{
+		installationID: t.installationID,
+		scope:          string(scope),
+		url:            req.URL.String(),
+		accept:         req.Header.Get("Accept"),
+		apiVersion:     req.Header.Get(apiVersionHeader),
+	}
+	cached, ok := t.Cache.get(key)
+	if ok {
+		req = req.Clone(req.Context())
+		if etag := cached.header.Get("ETag"); etag != "" {
+			req.Header.Set("If-None-Match", etag)
+		}
+		if lastModified := cached.header.Get("Last-Modified"); lastModified != "" {
+			req.Header.Set("If-Modified-Since", lastModified)
+		}
+	}
+
+	resp, err := t.tr.RoundTrip(req)
+	if err != nil {
+		return resp, err
+	}
+
+	switch {
+	case ok && resp.StatusCode == http.StatusNotModified:
+		io.Copy(io.Discard, resp.Body)
+		resp.Body.Close()
+		header := cached.header.Clone()
+		// The 304 carries current headers, such as the rate limit.
+		for k, v := range resp.Header {
+			header[k] = v
+		}
+		header.Set("X-From-Cache", "1")
+		return &http.Response{
+			Status:        "200 OK",
+			StatusCode:    http.StatusOK,
+			Proto:         resp.Proto,
+			ProtoMajor:    resp.ProtoMajor,
+			ProtoMinor:    resp.ProtoMinor,
+			Header:        header,
+			Body:          io.NopCloser(bytes.NewReader(cached.body)),
+			ContentLength: int64(len(cached.body)),
+			Request:       req,
+		}, nil
+	case resp.StatusCode == http.StatusOK && (resp.Header.Get("ETag") != "" || resp.Header.Get("Last-Modified") != ""):
+		body, err := io.ReadAll(io.LimitReader(resp.Body, maxCacheBody+1))
+		if err != nil || len(body) > maxCacheBody {
+			// Too large or failed to read, pass the response through uncached.
+			t.Cache.remove(key)
+			resp.Body = struct {
+				io.Reader
+				io.Closer
+			}{io.MultiReader(bytes.NewReader(body), resp.Body), resp.Body}
+			return resp, nil
+		}
+		resp.Body.Close()
+		resp.Body = io.NopCloser(bytes.NewReader(body))
+		t.Cache.add(&cacheEntry{key: key, header: resp.Header.Clone(), body: body})
+	case resp.StatusCode == http.StatusNotFound || resp.StatusCode == http.StatusGone:
+		t.Cache.remove(key)
+	}
+	return resp, nil
+}
@@ -0,0 +1,198 @@
+package ghinstallation
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+
+	"github.com/google/go-github/v69/github"
+)
+
+// newETagServer returns a server serving installation tokens and a resource
+// with a fixed ETag, counting the 304 Not Modified responses sent.
+func newETagServer(t *testing.T) (*httptest.Server, *atomic.Int32) {
+	var notModified atomic.Int32
+	ts := newTokenServer(t, func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("ETag", `"v1"`)
+		w.Header().Set("X-RateLimit-Remaining", "4999")
+		if r.Header.Get("If-None-Match") == `"v1"` {
+			notModified.Add(1)
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+		io.WriteString(w, `[{"number":1}]`)
+	})
+	return ts, &notModified
+}
+
+func newCacheTransport(t *testing.T, ts *httptest.Server, installationID int64, cache *Cache) *http.Client {
+	tr := newTestTransport(t, ts, installationID)
+	tr.Cache = cache
+	return &http.Client{Transport: tr}
+}
+
+func getBody(t *testing.T, client *http.Client, url string) (*http.Response, string) {
+	t.Helper()
+	resp, err := client.Get(url)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return resp, string(body)
+}
+
+func TestTransport_Cache(t *testing.T) {
+	ts, notModified := newETagServer(t)
+	client := newCacheTransport(t, ts, installationID, NewCache(10))
+
+	resp, body := getBody(t, client, ts.URL+"/repos/o/r/pulls")
+	if resp.Header.Get("X-From-Cache") != "" {
+		t.Error("first response marked as cached")
+	}
+	resp, cachedBody := getBody(t, client, ts.URL+"/repos/o/r/pulls")
+	if resp.StatusCode != http.StatusOK || resp.Header.Get("X-From-Cache") != "1" {
+		t.Errorf("second response = %d, X-From-Cache %q, want 200 from cache", resp.StatusCode, resp.Header.Get("X-From-Cache"))
+	}
+	if cachedBody != body {
+		t.Errorf("cached body = %q, want %q", cachedBody, body)
+	}
+	if resp.Header.Get("X-RateLimit-Remaining") != "4999" {
+		t.Error("cached response missing headers from the 304 response")
+	}
+	if n := notModified.Load(); n != 1 {
+		t.Errorf("304 responses = %d, want 1", n)
+	}
+}
+
+func TestTransport_CachePerInstallation(t *testing.T) {
+	ts, notModified := newETagServer(t)
+	cache := NewCache(10)
+	first := newCacheTransport(t, ts, 1, cache)
+	second := newCacheTransport(t, ts, 2, cache)
+
+	getBody(t, first, ts.URL+"/repos/o/r/pulls")
+	resp, _ := getBody(t, second, ts.URL+"/repos/o/r/pulls")
+	if resp.Header.Get("X-From-Cache") != "" || notModified.Load() != 0 {
+		t.Error("response cached for one installation was used by another")
+	}
+	if cache.Len() != 2 {
+		t.Errorf("Len() = %d, want 2", cache.Len())
+	}
+}
+
+func TestTransport_CachePerScope(t *testing.T) {
+	ts, notModified := newETagServer(t)
+	cache := NewCache(10)
+	first := newCacheTransport(t, ts, installationID, cache)
+	second := newCacheTransport(t, ts, installationID, cache)
+	second.Transport.(*Transport).InstallationTokenOptions = &github.InstallationTokenOptions{
+		Repositories: []string{"r"},
+	}
+
+	getBody(t, first, ts.URL+"/repos/o/r/pulls")
+	resp, _ := getBody(t, second, ts.URL+"/repos/o/r/pulls")
+	if resp.Header.Get("X-From-Cache") != "" || notModified.Load() != 0 {
+		t.Error("response cached for one token scope was used by another")
+	}
+
+	// A response is only reused for the same API version.
+	ctx := WithAPIVersion(context.Background(), "2022-11-28")
+	req, _ := http.NewRequestWithContext(ctx, http.MethodGet, ts.URL+"/repos/o/r/pulls", nil)
+	resp, err := first.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.Header.Get("X-From-Cache") != "" || notModified.Load() != 0 {
+		t.Error("response cached for one API version was used by another")
+	}
+	if cache.Len() != 3 {
+		t.Errorf("Len() = %d, want 3", cache.Len())
+	}
+}
+
+func TestTransport_CacheCallerConditional(t *testing.T) {
+	ts, _ := newETagServer(t)
+	client := newCacheTransport(t, ts, installationID, NewCache(10))
+	getBody(t, client, ts.URL+"/repos/o/r/pulls")
+
+	// A caller's own conditional request is passed through untouched.
+	req, _ := http.NewRequest(http.MethodGet, ts.URL+"/repos/o/r/pulls", nil)
+	req.Header.Set("If-None-Match", `"v1"`)
+	resp, err := client.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusNotModified {
+		t.Errorf("StatusCode = %d, want 304", resp.StatusCode)
+	}
+}
+
+func TestCache_evict(t *testing.T) {
+	c := NewCache(2)
+	keys := []cacheKey{{url: "a"}, {url: "b"}, {url: "c"}}
+	c.add(&cacheEntry{key: keys[0]})
+	c.add(&cacheEntry{key: keys[1]})
+	c.get(keys[0]) // a is now more recently used than b
+	c.add(&cacheEntry{key: keys[2]})
+
+	if _, ok := c.get(keys[1]); ok {
+		t.Error("least recently used entry was not evicted")
+	}
+	for _, k := range []cacheKey{keys[0], keys[2]} {
+		if _, ok := c.get(k); !ok {
+			t.Errorf("entry %q evicted", k.url)
+		}
+	}
+	if c.Len() != 2 {
+		t.Errorf("Len() = %d, want 2", c.Len())
+	}
+}
+
+func TestCache_evictSize(t *testing.T) {
+	c := NewCacheSize(10, 10)
+	keys := []cacheKey{{url: "a"}, {url: "b"}, {url: "c"}}
+	c.add(&cacheEntry{key: keys[0], body: []byte("aaaa")})
+	c.add(&cacheEntry{key: keys[1], body: []byte("bbbb")})
+	c.add(&cacheEntry{key: keys[2], body: []byte("cccc")})
+
+	if _, ok := c.get(keys[0]); ok {
+		t.Error("least recently used entry was not evicted")
+	}
+	if c.Len() != 2 || c.Size() != 8 {
+		t.Errorf("Len() = %d, Size() = %d, want 2 and 8", c.Len(), c.Size())
+	}
+
+	// Replacing an entry updates the size, and an entry larger than the
+	// budget is not kept.
+	c.add(&cacheEntry{key: keys[1], body: []byte("b")})
+	if c.Size() != 5 {
+		t.Errorf("Size() = %d, want 5", c.Size())
+	}
+	c.add(&cacheEntry{key: keys[0], body: []byte("aaaaaaaaaaa")})
+	if c.Len() != 0 || c.Size() != 0 {
+		t.Errorf("Len() = %d, Size() = %d, want an empty cache", c.Len(), c.Size())
+	}
+}
+
+func TestNewCache_default(t *testing.T) {
+	c := NewCache(0)
+	for i := 0; i <= defaultCacheEntries; i++ {
+		c.add(&cacheEntry{key: cacheKey{url: fmt.Sprint(i)}})
+	}
+	if c.Len() != defaultCacheEntries {
+		t.Errorf("Len() = %d, want %d", c.Len(), defaultCacheEntries)
+	}
+	if c.maxBytes != defaultCacheBytes {
+		t.Errorf("maxBytes = %d, want %d", c.maxBytes, defaultCacheBytes)
+	}
+}
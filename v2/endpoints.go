@@ -0,0 +1,163 @@
+package ghinstallation
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strings"
+)
+
+// dataResidencyDomain is the parent domain of GitHub Enterprise Cloud with
+// data residency tenants.
+const dataResidencyDomain = "ghe.com"
+
+// tenantPattern matches a data residency tenant's subdomain.
+var tenantPattern = regexp.MustCompile(`^[a-z0-9]([a-z0-9-]*[a-z0-9])?$`)
+
+// Endpoints are the URLs of a GitHub instance's APIs, without trailing
+// slashes.
+type Endpoints struct {
+	BaseURL    string // BaseURL is the REST API's URL, such as https://api.github.com
+	UploadURL  string // UploadURL is the uploads API's URL, such as https://uploads.github.com
+	GraphQLURL string // GraphQLURL is the GraphQL API's URL, such as https://api.github.com/graphql
+}
+
+// EnterpriseServerEndpoints returns the Endpoints of the GitHub Enterprise
+// Server instance at host, which may be a host name such as
+// github.example.com, or a URL such as https://github.example.com/ or
+// https://github.example.com/api/v3/. The scheme defaults to https.
+func EnterpriseServerEndpoints(host string) (Endpoints, error) {
+	s := strings.TrimSpace(host)
+	if !strings.Contains(s, "://") {
+		s = "https://" + s
+	}
+	u, err := url.Parse(s)
+	if err != nil {
+		return Endpoints{}, fmt.Errorf("could not parse GitHub Enterprise Server host %q: %w", host, err)
+	}
+	if u.Host == "" {
+		return Endpoints{}, fmt.Errorf("GitHub Enterprise Server host %q has no host name", host)
+	}
+	switch strings.TrimSuffix(u.Path, "/") {
+	case "", "/api/v3", "/api/uploads", "/api/graphql":
+	default:
+		return Endpoints{}, fmt.Errorf("GitHub Enterprise Server host %q has unexpected path %q", host, u.Path)
+	}
+	root := u.Scheme + "://" + u.Host
+	return Endpoints{
+		BaseURL:    root + "/api/v3",
+		UploadURL:  root + "/api/uploads",
+		GraphQLURL: root + "/api/graphql",
+	}, nil
+}
+
+// DataResidencyEndpoints returns the Endpoints of a GitHub Enterprise Cloud
+// with data residency tenant, whose APIs are served from api.<tenant>.ghe.com
+// and uploads.<tenant>.ghe.com. The tenant may be given as its subdomain,
+// such as acme, or its domain or URL, such as acme.ghe.com or
+// https://api.acme.ghe.com.
+func DataResidencyEndpoints(tenant string) (Endpoints, error) {
+	s := strings.ToLower(strings.TrimSpace(tenant))
+	if !strings.Contains(s, "://") {
+		s = "https://" + s
+	}
+	u, err := url.Parse(s)
+	if err != nil {
+		return Endpoints{}, fmt.Errorf("could not parse data residency tenant %q: %w", tenant, err)
+	}
+	if u.Scheme != "https" || u.Port() != "" || strings.TrimSuffix(u.Path, "/") != "" {
+		return Endpoints{}, fmt.Errorf("data residency tenant %q must be a subdomain or https://<tenant>.%s", tenant, dataResidencyDomain)
+	}
+	name := strings.TrimSuffix(u.Hostname(), "."+dataResidencyDomain)
+	name = strings.TrimPrefix(name, "api.")
+	if !tenantPattern.MatchString(name) {
+		return Endpoints{}, fmt.Errorf("data residency tenant %q is not a valid %s subdomain", tenant, dataResidencyDomain)
+	}
+	return endpointsFor("https://api." + name + "." + dataResidencyDomain), nil
+}
+
+// endpointsFor derives the Endpoints of the GitHub instance whose REST API
+// is at baseURL. GitHub Enterprise Server serves all APIs from one host under
+// /api, while other instances serve uploads from a sibling host.
+func endpointsFor(baseURL string) Endpoints {
+	baseURL = strings.TrimSuffix(baseURL, "/")
+	if root, ok := strings.CutSuffix(baseURL, "/api/v3"); ok {
+		return Endpoints{
+			BaseURL:    baseURL,
+			UploadURL:  root + "/api/uploads",
+			GraphQLURL: root + "/api/graphql",
+		}
+	}
+	e := Endpoints{
+		BaseURL:    baseURL,
+		UploadURL:  baseURL,
+		GraphQLURL: baseURL + "/graphql",
+	}
+	if u, err := url.Parse(baseURL); err == nil {
+		if rest, ok := strings.CutPrefix(u.Host, "api."); ok {
+			e.UploadURL = u.Scheme + "://uploads." + rest
+		}
+	}
+	return e
+}
+
+// Endpoints returns the URLs of the GitHub instance's APIs, derived from
+// BaseURL.
+func (t *Transport) Endpoints() Endpoints {
+	return endpointsFor(t.BaseURL)
+}
+
+// newAppsTransportAt returns an AppsTransport using private key for the
+// GitHub instance at e.
+func newAppsTransportAt(tr http.RoundTripper, e Endpoints, app AppIdentity, privateKey []byte) (*AppsTransport, error) {
+	atr, err := newAppsTransportFromKey(tr, app, privateKey)
+	if err != nil {
+		return nil, err
+	}
+	atr.BaseURL = e.BaseURL
+	return atr, nil
+}
+
+// NewEnterpriseAppsTransport returns an AppsTransport for the GitHub
+// Enterprise Server instance at host, see EnterpriseServerEndpoints and
+// NewAppsTransport.
+func NewEnterpriseAppsTransport(tr http.RoundTripper, host string, app AppIdentity, privateKey []byte) (*AppsTransport, error) {
+	e, err := EnterpriseServerEndpoints(host)
+	if err != nil {
+		return nil, err
+	}
+	return newAppsTransportAt(tr, e, app, privateKey)
+}
+
+// NewEnterprise returns a Transport for an installation on the GitHub
+// Enterprise Server instance at host, see EnterpriseServerEndpoints and New.
+func NewEnterprise(tr http.RoundTripper, host string, app AppIdentity, installationID int64, privateKey []byte) (*Transport, error) {
+	atr, err := NewEnterpriseAppsTransport(tr, host, app, privateKey)
+	if err != nil {
+		return nil, err
+	}
+	return NewFromAppsTransport(atr, installationID), nil
+}
+
+// NewDataResidencyAppsTransport returns an AppsTransport for the GitHub
+// Enterprise Cloud with data residency tenant, see DataResidencyEndpoints and
+// NewAppsTransport.
+func NewDataResidencyAppsTransport(tr http.RoundTripper, tenant string, app AppIdentity, privateKey []byte) (*AppsTransport, error) {
+	e, err := DataResidencyEndpoints(tenant)
+	if err != nil {
+		return nil, err
+	}
+	return newAppsTransportAt(tr, e, app, privateKey)
+}
+
+// NewDataResidency returns a Transport for an installation on the GitHub
+// Enterprise Cloud with data residency tenant, see DataResidencyEndpoints
+// and New.
+func NewDataResidency(tr http.RoundTripper, tenant string, app AppIdentity, installationID int64, privateKey []byte) (*Transport, error) {
+	atr, err := NewDataResidencyAppsTransport(tr, tenant, app, privateKey)
+	if err != nil {
+		return nil, err
+	}
+	return NewFromAppsTransport(atr, installationID), nil
+}
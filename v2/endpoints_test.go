@@ -0,0 +1,167 @@
+package ghinstallation
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestEnterpriseServerEndpoints(t *testing.T) {
+	want := Endpoints{
+		BaseURL:    "https://github.example.com/api/v3",
+		UploadURL:  "https://github.example.com/api/uploads",
+		GraphQLURL: "https://github.example.com/api/graphql",
+	}
+	for _, host := range []string{
+		"github.example.com",
+		" github.example.com ",
+		"https://github.example.com",
+		"https://github.example.com/",
+		"https://github.example.com/api/v3",
+		"https://github.example.com/api/v3/",
+		"https://github.example.com/api/uploads/",
+	} {
+		got, err := EnterpriseServerEndpoints(host)
+		if err != nil {
+			t.Errorf("EnterpriseServerEndpoints(%q): %v", host, err)
+			continue
+		}
+		if got != want {
+			t.Errorf("EnterpriseServerEndpoints(%q) = %+v, want %+v", host, got, want)
+		}
+	}
+
+	got, err := EnterpriseServerEndpoints("http://github.example.com:8080")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.BaseURL != "http://github.example.com:8080/api/v3" {
+		t.Errorf("BaseURL = %q, want the scheme and port kept", got.BaseURL)
+	}
+
+	for _, host := range []string{"", "https://", "https://github.example.com/other"} {
+		if _, err := EnterpriseServerEndpoints(host); err == nil {
+			t.Errorf("EnterpriseServerEndpoints(%q): expected error", host)
+		}
+	}
+}
+
+func TestTransport_Endpoints(t *testing.T) {
+	tests := map[string]Endpoints{
+		"https://api.github.com": {
+			BaseURL:    "https://api.github.com",
+			UploadURL:  "https://uploads.github.com",
+			GraphQLURL: "https://api.github.com/graphql",
+		},
+		"https://github.example.com/api/v3/": {
+			BaseURL:    "https://github.example.com/api/v3",
+			UploadURL:  "https://github.example.com/api/uploads",
+			GraphQLURL: "https://github.example.com/api/graphql",
+		},
+	}
+	for baseURL, want := range tests {
+		tr := &Transport{BaseURL: baseURL}
+		if got := tr.Endpoints(); got != want {
+			t.Errorf("BaseURL %q: Endpoints() = %+v, want %+v", baseURL, got, want)
+		}
+	}
+}
+
+func TestNewEnterprise(t *testing.T) {
+	var paths []string
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		paths = append(paths, r.URL.Path)
+		if strings.HasSuffix(r.URL.Path, "/access_tokens") {
+			fmt.Fprintf(w, `{"token":%q,"expires_at":%q}`, token, time.Now().Add(time.Hour).Format(time.RFC3339))
+			return
+		}
+		if r.Header.Get("Authorization") != "token "+token {
+			t.Errorf("%s: Authorization = %q, want the installation token", r.URL.Path, r.Header.Get("Authorization"))
+		}
+	}))
+	defer ts.Close()
+
+	tr, err := NewEnterprise(ts.Client().Transport, "http://"+ts.Listener.Addr().String()+"/", appID, installationID, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := ts.URL + "/api/v3"; tr.BaseURL != want {
+		t.Errorf("BaseURL = %q, want %q", tr.BaseURL, want)
+	}
+
+	client := &http.Client{Transport: tr}
+	for _, path := range []string{"/api/v3/repos/o/r", "/api/uploads/repos/o/r/releases/1/assets", "/api/graphql"} {
+		resp, err := client.Get(ts.URL + path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+	}
+	want := []string{fmt.Sprintf("/api/v3/app/installations/%v/access_tokens", installationID), "/api/v3/repos/o/r", "/api/uploads/repos/o/r/releases/1/assets", "/api/graphql"}
+	if strings.Join(paths, " ") != strings.Join(want, " ") {
+		t.Errorf("requests = %q, want %q", paths, want)
+	}
+}
+
+func TestDataResidencyEndpoints(t *testing.T) {
+	want := Endpoints{
+		BaseURL:    "https://api.acme.ghe.com",
+		UploadURL:  "https://uploads.acme.ghe.com",
+		GraphQLURL: "https://api.acme.ghe.com/graphql",
+	}
+	for _, tenant := range []string{
+		"acme",
+		"ACME",
+		"acme.ghe.com",
+		"api.acme.ghe.com",
+		"https://acme.ghe.com/",
+		"https://api.acme.ghe.com",
+	} {
+		got, err := DataResidencyEndpoints(tenant)
+		if err != nil {
+			t.Errorf("DataResidencyEndpoints(%q): %v", tenant, err)
+			continue
+		}
+		if got != want {
+			t.Errorf("DataResidencyEndpoints(%q) = %+v, want %+v", tenant, got, want)
+		}
+	}
+
+	for _, tenant := range []string{
+		"",
+		"acme.example.com",
+		"acme.ghe.com.example.com",
+		"http://acme.ghe.com",
+		"https://acme.ghe.com:8443",
+		"https://acme.ghe.com/api/v3",
+		"-acme",
+	} {
+		if _, err := DataResidencyEndpoints(tenant); err == nil {
+			t.Errorf("DataResidencyEndpoints(%q): expected error", tenant)
+		}
+	}
+}
+
+func TestNewDataResidency(t *testing.T) {
+	tr, err := NewDataResidency(http.DefaultTransport, "acme", appID, installationID, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if tr.BaseURL != "https://api.acme.ghe.com" || tr.appsTransport.BaseURL != tr.BaseURL {
+		t.Errorf("BaseURL = %q, AppsTransport BaseURL = %q, want https://api.acme.ghe.com", tr.BaseURL, tr.appsTransport.BaseURL)
+	}
+	for url, want := range map[string]bool{
+		"https://api.acme.ghe.com/repos/o/r":                       true,
+		"https://uploads.acme.ghe.com/repos/o/r/releases/1/assets": true,
+		"https://api.github.com/repos/o/r":                         false,
+		"https://api.other.ghe.com/repos/o/r":                      false,
+	} {
+		req := httptest.NewRequest(http.MethodGet, url, nil)
+		if got := tr.tokenAllowed(req.URL); got != want {
+			t.Errorf("tokenAllowed(%q) = %v, want %v", url, got, want)
+		}
+	}
+}
@@ -0,0 +1,235 @@
+// Package graphql provides a small client for GitHub's GraphQL API,
+// authenticated as a GitHub App installation by a ghinstallation.Transport.
+//
+// The client records the rate limit cost of queries and the installation's
+// remaining points, see Client.RateLimit.
+package graphql
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pagerguild/ghinstallation/v2"
+)
+
+// maxErrorBody bounds the body read from a non 2xx response.
+const maxErrorBody = 64 << 10
+
+// Error types reported by GitHub's GraphQL API, for use with errors.Is.
+var (
+	ErrNotFound    = &Error{Type: "NOT_FOUND"}
+	ErrForbidden   = &Error{Type: "FORBIDDEN"}
+	ErrRateLimited = &Error{Type: "RATE_LIMITED"}
+)
+
+// Error is an error returned in a GraphQL response's errors.
+type Error struct {
+	Message    string                 `json:"message"`
+	Type       string                 `json:"type,omitempty"`
+	Path       []interface{}          `json:"path,omitempty"`
+	Locations  []Location             `json:"locations,omitempty"`
+	Extensions map[string]interface{} `json:"extensions,omitempty"`
+}
+
+// Location is a position in a GraphQL query.
+type Location struct {
+	Line   int `json:"line"`
+	Column int `json:"column"`
+}
+
+func (e *Error) Error() string {
+	if e.Type == "" {
+		return e.Message
+	}
+	return fmt.Sprintf("%s: %s", e.Type, e.Message)
+}
+
+// Is reports whether target is an *Error of the same type, such as ErrNotFound.
+func (e *Error) Is(target error) bool {
+	t, ok := target.(*Error)
+	return ok && t.Message == "" && t.Type != "" && t.Type == e.Type
+}
+
+// Errors is returned by Client.Do when a GraphQL response has errors. The
+// response's data is still decoded, as it may be partial.
+type Errors []*Error
+
+func (e Errors) Error() string {
+	msgs := make([]string, len(e))
+	for i, err := range e {
+		msgs[i] = err.Error()
+	}
+	return "graphql: " + strings.Join(msgs, "; ")
+}
+
+// Unwrap returns the individual errors, so errors.Is and errors.As match them.
+func (e Errors) Unwrap() []error {
+	errs := make([]error, len(e))
+	for i, err := range e {
+		errs[i] = err
+	}
+	return errs
+}
+
+// ResponseError is returned by Client.Do when GitHub responds with a non 2xx
+// status.
+type ResponseError struct {
+	StatusCode int
+	Message    string // Message is GitHub's error message, if any
+	RequestID  string // RequestID is the X-GitHub-Request-Id header
+}
+
+func (e *ResponseError) Error() string {
+	return fmt.Sprintf("graphql: received non 2xx response status %d: %s", e.StatusCode, e.Message)
+}
+
+// RateLimit is the installation's GraphQL rate limit, as last reported.
+type RateLimit struct {
+	Cost      int       // Cost is the cost of the last query selecting rateLimit { cost }
+	TotalCost int       // TotalCost is the sum of the costs reported for queries made by the Client
+	Limit     int       // Limit is the number of points allowed per window
+	Remaining int       // Remaining is the number of points left in the window
+	ResetAt   time.Time // ResetAt is when the window resets
+}
+
+// Client sends GraphQL queries to the GitHub instance of a Transport.
+// A Client is safe for concurrent use.
+type Client struct {
+	tr   *ghinstallation.Transport
+	http *http.Client
+
+	mu        sync.Mutex // mu protects rateLimit
+	rateLimit RateLimit
+}
+
+// New returns a Client authenticating with tr's installation, and sending
+// queries to the GraphQL API of tr's GitHub instance, see
+// ghinstallation.Transport.Endpoints. The API's URL is derived from tr's
+// BaseURL for each query, so BaseURL may be set after New.
+func New(tr *ghinstallation.Transport) *Client {
+	return &Client{
+		tr:   tr,
+		http: &http.Client{Transport: tr},
+	}
+}
+
+// Do sends query with variables, decoding the response's data into data,
+// which may be nil. If the response has errors, they are returned as Errors.
+//
+// To record a query's cost, select rateLimit { cost } in the query, the
+// installation's remaining points are recorded from every response.
+func (c *Client) Do(ctx context.Context, query string, variables map[string]interface{}, data interface{}) error {
+	body, err := json.Marshal(struct {
+		Query     string                 `json:"query"`
+		Variables map[string]interface{} `json:"variables,omitempty"`
+	}{query, variables})
+	if err != nil {
+		return fmt.Errorf("graphql: could not encode request: %w", err)
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, c.tr.Endpoints().GraphQLURL, bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("graphql: could not create request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Accept", "application/json")
+
+	resp, err := c.http.Do(req)
+	if err != nil {
+		return fmt.Errorf("graphql: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode/100 != 2 {
+		rerr := &ResponseError{StatusCode: resp.StatusCode, RequestID: resp.Header.Get("X-GitHub-Request-Id")}
+		var apiErr struct {
+			Message string `json:"message"`
+		}
+		if json.NewDecoder(io.LimitReader(resp.Body, maxErrorBody)).Decode(&apiErr) == nil {
+			rerr.Message = apiErr.Message
+		}
+		return rerr
+	}
+
+	var out struct {
+		Data   json.RawMessage `json:"data"`
+		Errors Errors          `json:"errors"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&out); err != nil {
+		return fmt.Errorf("graphql: could not decode response: %w", err)
+	}
+	c.recordRateLimit(resp.Header, out.Data)
+
+	if data != nil && len(out.Data) > 0 && !bytes.Equal(out.Data, []byte("null")) {
+		if err := json.Unmarshal(out.Data, data); err != nil {
+			return fmt.Errorf("graphql: could not decode data: %w", err)
+		}
+	}
+	if len(out.Errors) > 0 {
+		return out.Errors
+	}
+	return nil
+}
+
+// recordRateLimit records the rate limit reported by the response's headers
+// h, and the cost from data's rateLimit field if selected.
+func (c *Client) recordRateLimit(h http.Header, data json.RawMessage) {
+	var selected struct {
+		RateLimit *struct {
+			Cost      int       `json:"cost"`
+			Limit     int       `json:"limit"`
+			Remaining int       `json:"remaining"`
+			ResetAt   time.Time `json:"resetAt"`
+		} `json:"rateLimit"`
+	}
+	json.Unmarshal(data, &selected)
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if limit, remaining, reset, ok := parseRateLimit(h); ok {
+		c.rateLimit.Limit, c.rateLimit.Remaining, c.rateLimit.ResetAt = limit, remaining, reset
+	}
+	if rl := selected.RateLimit; rl != nil {
+		c.rateLimit.Cost = rl.Cost
+		c.rateLimit.TotalCost += rl.Cost
+		if rl.Limit > 0 {
+			c.rateLimit.Limit, c.rateLimit.Remaining, c.rateLimit.ResetAt = rl.Limit, rl.Remaining, rl.ResetAt
+		}
+	}
+}
+
+// parseRateLimit parses GitHub's X-RateLimit-* headers, ignoring those
+// reporting a resource other than graphql.
+func parseRateLimit(h http.Header) (limit, remaining int, reset time.Time, ok bool) {
+	if r := h.Get("X-RateLimit-Resource"); r != "" && r != "graphql" {
+		return 0, 0, time.Time{}, false
+	}
+	limit, err := strconv.Atoi(h.Get("X-RateLimit-Limit"))
+	if err != nil {
+		return 0, 0, time.Time{}, false
+	}
+	remaining, err = strconv.Atoi(h.Get("X-RateLimit-Remaining"))
+	if err != nil {
+		return 0, 0, time.Time{}, false
+	}
+	sec, err := strconv.ParseInt(h.Get("X-RateLimit-Reset"), 10, 64)
+	if err != nil {
+		return 0, 0, time.Time{}, false
+	}
+	return limit, remaining, time.Unix(sec, 0), true
+}
+
+// RateLimit returns the installation's GraphQL rate limit and the cost of
+// queries made by the Client.
+func (c *Client) RateLimit() RateLimit {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.rateLimit
+}
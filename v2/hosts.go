@@ -0,0 +1,61 @@
+package ghinstallation
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// HostNotAllowedError is returned by Transport when RejectUnknownHosts is set
+// and a request is for a host the installation token may not be sent to.
+type HostNotAllowedError struct {
+	Scheme string
+	Host   string
+}
+
+func (e *HostNotAllowedError) Error() string {
+	return fmt.Sprintf("refusing to send installation token to %s://%s, it does not match BaseURL or AllowedHosts", e.Scheme, e.Host)
+}
+
+// tokenAllowed reports whether the installation token may be sent to u: the
+// scheme and host of BaseURL or the uploads API, or one of AllowedHosts over
+// https or BaseURL's scheme.
+func (t *Transport) tokenAllowed(u *url.URL) bool {
+	host := strings.ToLower(u.Host)
+	e := t.Endpoints()
+	baseScheme := "https"
+	for _, endpoint := range []string{e.BaseURL, e.UploadURL} {
+		eu, err := url.Parse(endpoint)
+		if err != nil || eu.Host == "" {
+			continue
+		}
+		if endpoint == e.BaseURL {
+			baseScheme = eu.Scheme
+		}
+		if eu.Scheme == u.Scheme && strings.ToLower(eu.Host) == host {
+			return true
+		}
+	}
+	if u.Scheme != "https" && u.Scheme != baseScheme {
+		return false
+	}
+	for _, allowed := range t.AllowedHosts {
+		allowed = strings.ToLower(allowed)
+		if allowed == host || allowed == strings.ToLower(u.Hostname()) {
+			return true
+		}
+	}
+	return false
+}
+
+// roundTripUnauthenticated handles a request the installation token may not
+// be sent with, sending it without the token or rejecting it. Requests
+// redirected away from an allowed host are always sent without the token.
+func (t *Transport) roundTripUnauthenticated(req *http.Request) (*http.Response, error) {
+	if t.RejectUnknownHosts && !t.tokenAllowed(req.URL) {
+		closeRequestBody(req)
+		return nil, &HostNotAllowedError{Scheme: req.URL.Scheme, Host: req.URL.Host}
+	}
+	return t.tr.RoundTrip(t.stripToken(req))
+}
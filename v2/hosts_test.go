@@ -0,0 +1,77 @@
+package ghinstallation
+
+import (
+	"errors"
+	"net/http"
+	"net/url"
+	"testing"
+	"time"
+)
+
+func TestTransport_tokenAllowed(t *testing.T) {
+	tests := []struct {
+		baseURL string
+		allowed []string
+		url     string
+		want    bool
+	}{
+		{"https://api.github.com", nil, "https://api.github.com/repos/o/r", true},
+		{"https://api.github.com", nil, "https://API.github.com/repos/o/r", true},
+		{"https://api.github.com", nil, "https://uploads.github.com/repos/o/r/releases/1/assets", true},
+		{"https://api.github.com", nil, "https://objects.githubusercontent.com/asset", false},
+		{"https://api.github.com", nil, "https://api.github.com.evil.com/", false},
+		{"https://api.github.com", nil, "https://example.com/", false},
+		{"https://api.github.com", []string{"example.com"}, "https://example.com/", true},
+		{"https://api.github.com", []string{"example.com:8443"}, "https://example.com/", false},
+		{"https://github.example.com/api/v3", nil, "https://github.example.com/api/uploads/repos", true},
+		{"https://github.example.com/api/v3", nil, "https://uploads.example.com/", false},
+		{"https://api.acme.ghe.com", nil, "https://uploads.acme.ghe.com/", true},
+		{"https://api.github.com", nil, "http://api.github.com/repos/o/r", false},
+		{"https://api.github.com", nil, "http://uploads.github.com/repos/o/r/releases/1/assets", false},
+		{"https://api.github.com", []string{"example.com"}, "http://example.com/", false},
+		{"http://github.example.com/api/v3", nil, "http://github.example.com/api/v3/repos/o/r", true},
+		{"http://github.example.com/api/v3", []string{"example.com"}, "http://example.com/", true},
+	}
+	for _, tt := range tests {
+		tr := &Transport{BaseURL: tt.baseURL, AllowedHosts: tt.allowed}
+		u, err := url.Parse(tt.url)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := tr.tokenAllowed(u); got != tt.want {
+			t.Errorf("BaseURL %q, AllowedHosts %q: tokenAllowed(%q) = %v, want %v", tt.baseURL, tt.allowed, tt.url, got, tt.want)
+		}
+	}
+}
+
+func TestTransport_unknownHost(t *testing.T) {
+	var got *http.Request
+	rt := &RoundTrip{rt: func(req *http.Request) (*http.Response, error) {
+		got = req
+		return &http.Response{StatusCode: http.StatusOK, Body: http.NoBody}, nil
+	}}
+	tr, err := New(rt, appID, installationID, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tr.token = &accessToken{Token: token, ExpiresAt: time.Now().Add(time.Hour)}
+
+	req, _ := http.NewRequest(http.MethodGet, "https://objects.githubusercontent.com/asset", nil)
+	if _, err := tr.RoundTrip(req); err != nil {
+		t.Fatal(err)
+	}
+	if got == nil || got.Header.Get("Authorization") != "" {
+		t.Errorf("request to unknown host sent with Authorization %q, want none", got.Header.Get("Authorization"))
+	}
+
+	got = nil
+	tr.RejectUnknownHosts = true
+	_, err = tr.RoundTrip(req)
+	var hostErr *HostNotAllowedError
+	if !errors.As(err, &hostErr) || hostErr.Scheme != "https" || hostErr.Host != "objects.githubusercontent.com" {
+		t.Errorf("error = %v, want *HostNotAllowedError", err)
+	}
+	if got != nil {
+		t.Error("request to unknown host sent with RejectUnknownHosts set")
+	}
+}
@@ -0,0 +1,69 @@
+package ghinstallation
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// clientIDPattern matches GitHub App client IDs, in both the legacy Iv1.
+// format and the current Iv23 format.
+var clientIDPattern = regexp.MustCompile(`^(Iv1\.[0-9a-f]{16}|Iv23[0-9A-Za-z]{16})$`)
+
+// AppIdentity identifies a GitHub App by either its numeric app ID or its
+// client ID, both of which GitHub accepts as the issuer of the app's JWT.
+//
+// An AppIdentity may be created with AppID or ClientID, or from a string
+// containing either form, such as the untyped constant "Iv1.0123456789abcdef".
+// Constructors validate the identity and return an error if it is invalid.
+// Constructors such as New, which predate AppIdentity, take the identity as
+// a string.
+type AppIdentity string
+
+// AppID returns the AppIdentity for the numeric app ID id.
+func AppID(id int64) AppIdentity {
+	return AppIdentity(strconv.FormatInt(id, 10))
+}
+
+// ClientID returns the AppIdentity for the client ID id, such as
+// "Iv1.0123456789abcdef" or "Iv23li0123456789abcd".
+func ClientID(id string) AppIdentity {
+	return AppIdentity(id)
+}
+
+// AppID returns the numeric app ID, if a is an app ID in canonical form,
+// without a sign or leading zeros, as GitHub compares the JWT's issuer with
+// the app ID as a string.
+func (a AppIdentity) AppID() (int64, bool) {
+	id, err := strconv.ParseInt(string(a), 10, 64)
+	return id, err == nil && id > 0 && strconv.FormatInt(id, 10) == string(a)
+}
+
+// ClientID returns the client ID, if a is a client ID.
+func (a AppIdentity) ClientID() (string, bool) {
+	return string(a), clientIDPattern.MatchString(string(a))
+}
+
+// Validate returns an error if a is neither a valid app ID nor client ID.
+func (a AppIdentity) Validate() error {
+	if _, ok := a.AppID(); ok {
+		return nil
+	}
+	if _, ok := a.ClientID(); ok {
+		return nil
+	}
+	if strings.TrimSpace(string(a)) != string(a) {
+		return fmt.Errorf("invalid GitHub App identity %q: contains leading or trailing whitespace", string(a))
+	}
+	return fmt.Errorf("invalid GitHub App identity %q: must be a positive numeric app ID without leading zeros, or a client ID beginning Iv1. or Iv23", string(a))
+}
+
+// String returns a description of a for use in errors, such as
+// "app ID 42" or "client ID Iv1.0123456789abcdef".
+func (a AppIdentity) String() string {
+	if id, ok := a.AppID(); ok {
+		return "app ID " + strconv.FormatInt(id, 10)
+	}
+	return "client ID " + string(a)
+}
@@ -0,0 +1,96 @@
+package ghinstallation
+
+import (
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+func TestAppIdentity(t *testing.T) {
+	tests := []struct {
+		app       AppIdentity
+		valid     bool
+		appID     int64
+		clientID  string
+		formatted string
+	}{
+		{app: AppID(42), valid: true, appID: 42, formatted: "app ID 42"},
+		{app: "42", valid: true, appID: 42, formatted: "app ID 42"},
+		{app: ClientID("Iv1.0123456789abcdef"), valid: true, clientID: "Iv1.0123456789abcdef", formatted: "client ID Iv1.0123456789abcdef"},
+		{app: ClientID("Iv23li0123456789ABCD"), valid: true, clientID: "Iv23li0123456789ABCD", formatted: "client ID Iv23li0123456789ABCD"},
+		{app: AppID(0)},
+		{app: AppID(-1)},
+		{app: ""},
+		{app: " 42"},
+		{app: "0042"},
+		{app: "+42"},
+		{app: "Iv1.0123"},
+		{app: "Iv1.0123456789ABCDEF"},
+		{app: "Ov23li0123456789ABCD"},
+		{app: "appID123"},
+	}
+	for _, tt := range tests {
+		t.Run(string(tt.app), func(t *testing.T) {
+			if err := tt.app.Validate(); (err == nil) != tt.valid {
+				t.Fatalf("Validate() = %v, want valid %v", err, tt.valid)
+			}
+			if !tt.valid {
+				return
+			}
+			if id, ok := tt.app.AppID(); ok != (tt.appID != 0) || id != tt.appID {
+				t.Errorf("AppID() = %d, %v, want %d", id, ok, tt.appID)
+			}
+			if id, ok := tt.app.ClientID(); ok != (tt.clientID != "") || (ok && id != tt.clientID) {
+				t.Errorf("ClientID() = %q, %v, want %q", id, ok, tt.clientID)
+			}
+			if got := tt.app.String(); got != tt.formatted {
+				t.Errorf("String() = %q, want %q", got, tt.formatted)
+			}
+		})
+	}
+}
+
+func TestAppIdentity_constructors(t *testing.T) {
+	if _, err := New(&http.Transport{}, "appID123", installationID, key); err == nil {
+		t.Error("New: expected error for invalid app identity")
+	}
+	if _, err := NewAppsTransport(&http.Transport{}, string(AppID(0)), key); err == nil {
+		t.Error("NewAppsTransport: expected error for invalid app identity")
+	}
+	if _, err := NewAppsTransportFromSigner(&http.Transport{}, AppID(0), nil); err == nil {
+		t.Error("NewAppsTransportFromSigner: expected error for invalid app identity")
+	}
+
+	// The constructors of earlier releases take the identity as a string.
+	clientID := string(ClientID("Iv23li0123456789ABCD"))
+	if _, err := New(&http.Transport{}, clientID, installationID, key); err != nil {
+		t.Errorf("New: %v", err)
+	}
+
+	// The identity is used as the JWT issuer.
+	for _, app := range []AppIdentity{AppID(42), ClientID("Iv23li0123456789ABCD")} {
+		check := RoundTrip{
+			rt: func(req *http.Request) (*http.Response, error) {
+				token := strings.Fields(req.Header.Get("Authorization"))[1]
+				claims := &jwt.RegisteredClaims{}
+				if _, _, err := jwt.NewParser().ParseUnverified(token, claims); err != nil {
+					t.Fatal(err)
+				}
+				if claims.Issuer != string(app) {
+					t.Errorf("iss = %q, want %q", claims.Issuer, app)
+				}
+				return nil, nil
+			},
+		}
+		tr, err := NewAppsTransport(check, string(app), key)
+		if err != nil {
+			t.Fatal(err)
+		}
+		req, _ := http.NewRequest(http.MethodGet, "http://example.com", nil)
+		if _, err := tr.RoundTrip(req); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
@@ -0,0 +1,57 @@
+package ghinstallation
+
+import (
+	"fmt"
+	"reflect"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// JWTHook customizes an AppsTransport's JWT before it is signed, such as
+// adding a kid header or a jti claim for an egress gateway.
+//
+// The header and claims are initialized with the values GitHub requires, and
+// the hook may add to them. The alg and typ headers and the iss, iat and exp
+// claims must not be modified or removed, otherwise signing fails with an
+// error.
+type JWTHook func(header, claims map[string]interface{}) error
+
+// protectedJWTHeaders are the JWT headers a JWTHook must not modify.
+var protectedJWTHeaders = []string{"alg", "typ"}
+
+// protectedJWTClaims are the JWT claims a JWTHook must not modify.
+var protectedJWTClaims = []string{"iss", "iat", "exp"}
+
+// applyJWTHook calls hook with the headers and claims of token, returning a
+// new token with the customized headers and claims.
+func applyJWTHook(hook JWTHook, token *jwt.Token, claims *jwt.RegisteredClaims) (*jwt.Token, error) {
+	mapClaims := jwt.MapClaims{
+		"iss": claims.Issuer,
+		"iat": claims.IssuedAt.Unix(),
+		"exp": claims.ExpiresAt.Unix(),
+	}
+	header := make(map[string]interface{}, len(token.Header))
+	for k, v := range token.Header {
+		header[k] = v
+	}
+
+	if err := hook(header, mapClaims); err != nil {
+		return nil, fmt.Errorf("jwt hook failed: %w", err)
+	}
+
+	for _, k := range protectedJWTHeaders {
+		if !reflect.DeepEqual(header[k], token.Header[k]) {
+			return nil, fmt.Errorf("jwt hook must not modify the %q header", k)
+		}
+	}
+	want := jwt.MapClaims{"iss": claims.Issuer, "iat": claims.IssuedAt.Unix(), "exp": claims.ExpiresAt.Unix()}
+	for _, k := range protectedJWTClaims {
+		if !reflect.DeepEqual(mapClaims[k], want[k]) {
+			return nil, fmt.Errorf("jwt hook must not modify the %q claim", k)
+		}
+	}
+
+	customized := jwt.NewWithClaims(token.Method, mapClaims)
+	customized.Header = header
+	return customized, nil
+}
@@ -0,0 +1,83 @@
+package ghinstallation
+
+import (
+	"errors"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+func TestJWTHook(t *testing.T) {
+	pk, err := jwt.ParseRSAPrivateKeyFromPEM(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	check := RoundTrip{
+		rt: func(req *http.Request) (*http.Response, error) {
+			token := strings.Fields(req.Header.Get("Authorization"))[1]
+			claims := jwt.MapClaims{}
+			tok, err := jwt.NewParser(jwt.WithValidMethods([]string{"RS256"}), jwt.WithIssuer(appID)).ParseWithClaims(token, claims, func(*jwt.Token) (interface{}, error) {
+				return pk.Public(), nil
+			})
+			if err != nil {
+				t.Fatalf("jwt parse: %v", err)
+			}
+			if got := tok.Header["kid"]; got != "key-2024" {
+				t.Errorf("kid header = %v, want key-2024", got)
+			}
+			if got := claims["jti"]; got != "request-1" {
+				t.Errorf("jti claim = %v, want request-1", got)
+			}
+			if _, ok := claims["iat"].(float64); !ok {
+				t.Errorf("iat claim = %v, want a number", claims["iat"])
+			}
+			return nil, nil
+		},
+	}
+
+	tr := NewAppsTransportFromPrivateKey(check, appID, pk)
+	tr.JWTHook = func(header, claims map[string]interface{}) error {
+		header["kid"] = "key-2024"
+		claims["jti"] = "request-1"
+		return nil
+	}
+	req, _ := http.NewRequest(http.MethodGet, "http://example.com", nil)
+	if _, err := tr.RoundTrip(req); err != nil {
+		t.Fatalf("error calling RoundTrip: %v", err)
+	}
+}
+
+func TestJWTHook_protected(t *testing.T) {
+	wantErr := errors.New("hook failed")
+	tests := []struct {
+		name string
+		hook JWTHook
+	}{
+		{name: "iss", hook: func(header, claims map[string]interface{}) error { claims["iss"] = "other"; return nil }},
+		{name: "iat", hook: func(header, claims map[string]interface{}) error { claims["iat"] = 0; return nil }},
+		{name: "exp removed", hook: func(header, claims map[string]interface{}) error { delete(claims, "exp"); return nil }},
+		{name: "alg", hook: func(header, claims map[string]interface{}) error { header["alg"] = "none"; return nil }},
+		{name: "error", hook: func(header, claims map[string]interface{}) error { return wantErr }},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tr, err := NewAppsTransport(RoundTrip{
+				rt: func(req *http.Request) (*http.Response, error) {
+					t.Fatal("request sent despite hook error")
+					return nil, nil
+				},
+			}, appID, key)
+			if err != nil {
+				t.Fatal(err)
+			}
+			tr.JWTHook = tt.hook
+			req, _ := http.NewRequest(http.MethodGet, "http://example.com", nil)
+			if _, err := tr.RoundTrip(req); err == nil {
+				t.Fatal("expected error")
+			}
+		})
+	}
+}
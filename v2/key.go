@@ -0,0 +1,368 @@
+package ghinstallation
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/des"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/hmac"
+	"crypto/rsa"
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/sha512"
+	"crypto/x509"
+	"encoding/asn1"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"hash"
+	"math/big"
+)
+
+var (
+	// ErrPassphraseRequired is returned when a private key is encrypted and
+	// no passphrase was provided.
+	ErrPassphraseRequired = errors.New("private key is encrypted, a passphrase is required")
+	// ErrIncorrectPassphrase is returned when an encrypted private key could
+	// not be decrypted with the provided passphrase.
+	ErrIncorrectPassphrase = errors.New("private key could not be decrypted, incorrect passphrase")
+)
+
+// UnsupportedKeyError is returned when key material is recognised, but is not
+// an RSA private key, such as an EC key or a certificate.
+type UnsupportedKeyError struct {
+	Format string // Format describes the key material, such as "EC private key"
+}
+
+func (e *UnsupportedKeyError) Error() string {
+	return fmt.Sprintf("unsupported key: %s, GitHub Apps require an RSA private key", e.Format)
+}
+
+// ParsePrivateKey parses an RSA private key, detecting its format. Supported
+// formats are:
+//
+//   - PEM encoded PKCS #1 ("RSA PRIVATE KEY"), optionally encrypted using
+//     the legacy Proc-Type and DEK-Info headers
+//   - PEM encoded PKCS #8 ("PRIVATE KEY")
+//   - PEM encoded encrypted PKCS #8 ("ENCRYPTED PRIVATE KEY") using PBES2
+//     with PBKDF2 and AES-CBC or 3DES-CBC
+//   - DER encoded PKCS #1 or PKCS #8
+//   - JSON Web Keys (JWK) with "kty": "RSA"
+//   - Base64 encoding of any of the above, as is common for environment
+//     variables
+//
+// OpenSSH private keys are not supported, and may be converted to PEM encoded
+// PKCS #1 with ssh-keygen -p -m PEM.
+//
+// The passphrase is only used for encrypted keys, and may be nil otherwise.
+func ParsePrivateKey(data, passphrase []byte) (*rsa.PrivateKey, error) {
+	return parsePrivateKey(data, passphrase, true)
+}
+
+func parsePrivateKey(data, passphrase []byte, tryBase64 bool) (*rsa.PrivateKey, error) {
+	data = bytes.TrimSpace(data)
+	switch {
+	case len(data) == 0:
+		return nil, errors.New("private key is empty")
+	case data[0] == '{':
+		return parseJWK(data)
+	case bytes.Contains(data, []byte("-----BEGIN ")):
+		return parsePEM(data, passphrase)
+	}
+
+	if key, err := parseDER(data); err == nil {
+		return key, nil
+	} else if _, ok := err.(*UnsupportedKeyError); ok {
+		return nil, err
+	}
+
+	if tryBase64 {
+		for _, enc := range []*base64.Encoding{base64.StdEncoding, base64.RawStdEncoding, base64.URLEncoding, base64.RawURLEncoding} {
+			if decoded, err := enc.DecodeString(string(data)); err == nil {
+				return parsePrivateKey(decoded, passphrase, false)
+			}
+		}
+	}
+	return nil, errors.New("private key format not recognised, expected PEM, DER, JWK or base64")
+}
+
+// parsePEM parses the first PEM block in data.
+func parsePEM(data, passphrase []byte) (*rsa.PrivateKey, error) {
+	block, _ := pem.Decode(data[bytes.Index(data, []byte("-----BEGIN ")):])
+	if block == nil {
+		return nil, errors.New("private key PEM block could not be decoded")
+	}
+
+	switch block.Type {
+	case "RSA PRIVATE KEY":
+		der := block.Bytes
+		// Legacy encrypted PEM is deprecated, but still produced by many tools.
+		if x509.IsEncryptedPEMBlock(block) {
+			if len(passphrase) == 0 {
+				return nil, ErrPassphraseRequired
+			}
+			var err error
+			if der, err = x509.DecryptPEMBlock(block, passphrase); err != nil {
+				return nil, ErrIncorrectPassphrase
+			}
+		}
+		key, err := x509.ParsePKCS1PrivateKey(der)
+		if err != nil {
+			return nil, fmt.Errorf("could not parse PKCS #1 private key: %s", err)
+		}
+		return key, nil
+	case "PRIVATE KEY":
+		return parsePKCS8(block.Bytes)
+	case "ENCRYPTED PRIVATE KEY":
+		if len(passphrase) == 0 {
+			return nil, ErrPassphraseRequired
+		}
+		der, err := decryptPKCS8(block.Bytes, passphrase)
+		if err != nil {
+			return nil, err
+		}
+		return parsePKCS8(der)
+	case "OPENSSH PRIVATE KEY":
+		return nil, &UnsupportedKeyError{Format: "OpenSSH private key, convert it with ssh-keygen -p -m PEM"}
+	case "EC PRIVATE KEY":
+		return nil, &UnsupportedKeyError{Format: "EC private key"}
+	case "PUBLIC KEY", "RSA PUBLIC KEY":
+		return nil, &UnsupportedKeyError{Format: "public key"}
+	case "CERTIFICATE":
+		return nil, &UnsupportedKeyError{Format: "certificate"}
+	default:
+		return nil, &UnsupportedKeyError{Format: fmt.Sprintf("PEM block type %q", block.Type)}
+	}
+}
+
+// parseDER parses a DER encoded PKCS #1 or PKCS #8 private key.
+func parseDER(der []byte) (*rsa.PrivateKey, error) {
+	if key, err := x509.ParsePKCS1PrivateKey(der); err == nil {
+		return key, nil
+	}
+	return parsePKCS8(der)
+}
+
+// parsePKCS8 parses a DER encoded PKCS #8 private key, which must be an RSA key.
+func parsePKCS8(der []byte) (*rsa.PrivateKey, error) {
+	key, err := x509.ParsePKCS8PrivateKey(der)
+	if err != nil {
+		return nil, fmt.Errorf("could not parse PKCS #8 private key: %s", err)
+	}
+	return rsaKey(key)
+}
+
+// rsaKey returns key as an *rsa.PrivateKey, or an UnsupportedKeyError
+// describing the key.
+func rsaKey(key interface{}) (*rsa.PrivateKey, error) {
+	switch k := key.(type) {
+	case *rsa.PrivateKey:
+		return k, nil
+	case *ecdsa.PrivateKey:
+		return nil, &UnsupportedKeyError{Format: "EC private key"}
+	case ed25519.PrivateKey:
+		return nil, &UnsupportedKeyError{Format: "Ed25519 private key"}
+	default:
+		return nil, &UnsupportedKeyError{Format: fmt.Sprintf("%T", key)}
+	}
+}
+
+// jwk is a JSON Web Key, as defined in RFC 7517 and RFC 7518.
+type jwk struct {
+	Kty string `json:"kty"`
+	Crv string `json:"crv"`
+	N   string `json:"n"`
+	E   string `json:"e"`
+	D   string `json:"d"`
+	P   string `json:"p"`
+	Q   string `json:"q"`
+}
+
+// parseJWK parses an RSA private key from a JSON Web Key.
+func parseJWK(data []byte) (*rsa.PrivateKey, error) {
+	var k jwk
+	if err := json.Unmarshal(data, &k); err != nil {
+		return nil, fmt.Errorf("could not parse JWK: %s", err)
+	}
+	switch k.Kty {
+	case "RSA":
+	case "EC":
+		return nil, &UnsupportedKeyError{Format: fmt.Sprintf("EC JWK (curve %q)", k.Crv)}
+	case "OKP":
+		return nil, &UnsupportedKeyError{Format: fmt.Sprintf("OKP JWK (curve %q)", k.Crv)}
+	default:
+		return nil, &UnsupportedKeyError{Format: fmt.Sprintf("JWK key type %q", k.Kty)}
+	}
+	if k.D == "" {
+		return nil, &UnsupportedKeyError{Format: "public JWK"}
+	}
+
+	var n, e, d, p, q big.Int
+	for _, f := range []struct {
+		name string
+		val  string
+		dst  *big.Int
+	}{{"n", k.N, &n}, {"e", k.E, &e}, {"d", k.D, &d}, {"p", k.P, &p}, {"q", k.Q, &q}} {
+		b, err := base64.RawURLEncoding.DecodeString(f.val)
+		if err != nil || len(b) == 0 {
+			return nil, fmt.Errorf("could not parse JWK: invalid or missing %q", f.name)
+		}
+		f.dst.SetBytes(b)
+	}
+	if !e.IsInt64() {
+		return nil, errors.New("could not parse JWK: exponent too large")
+	}
+
+	key := &rsa.PrivateKey{
+		PublicKey: rsa.PublicKey{N: &n, E: int(e.Int64())},
+		D:         &d,
+		Primes:    []*big.Int{&p, &q},
+	}
+	if err := key.Validate(); err != nil {
+		return nil, fmt.Errorf("could not parse JWK: %s", err)
+	}
+	key.Precompute()
+	return key, nil
+}
+
+var (
+	oidPBES2      = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 5, 13}
+	oidPBKDF2     = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 5, 12}
+	oidHMACSHA1   = asn1.ObjectIdentifier{1, 2, 840, 113549, 2, 7}
+	oidHMACSHA256 = asn1.ObjectIdentifier{1, 2, 840, 113549, 2, 9}
+	oidHMACSHA512 = asn1.ObjectIdentifier{1, 2, 840, 113549, 2, 11}
+	oidAES128CBC  = asn1.ObjectIdentifier{2, 16, 840, 1, 101, 3, 4, 1, 2}
+	oidAES192CBC  = asn1.ObjectIdentifier{2, 16, 840, 1, 101, 3, 4, 1, 22}
+	oidAES256CBC  = asn1.ObjectIdentifier{2, 16, 840, 1, 101, 3, 4, 1, 42}
+	oidDESEDE3CBC = asn1.ObjectIdentifier{1, 2, 840, 113549, 3, 7}
+)
+
+// encryptedPrivateKeyInfo is defined in RFC 5208.
+type encryptedPrivateKeyInfo struct {
+	Algorithm     pkixAlgorithm
+	EncryptedData []byte
+}
+
+type pkixAlgorithm struct {
+	Algorithm  asn1.ObjectIdentifier
+	Parameters asn1.RawValue `asn1:"optional"`
+}
+
+// pbes2Params is defined in RFC 8018.
+type pbes2Params struct {
+	KeyDerivationFunc pkixAlgorithm
+	EncryptionScheme  pkixAlgorithm
+}
+
+// pbkdf2Params is defined in RFC 8018.
+type pbkdf2Params struct {
+	Salt           []byte
+	IterationCount int
+	KeyLength      int           `asn1:"optional"`
+	PRF            pkixAlgorithm `asn1:"optional"`
+}
+
+// decryptPKCS8 decrypts a DER encoded encrypted PKCS #8 private key.
+func decryptPKCS8(der, passphrase []byte) ([]byte, error) {
+	var info encryptedPrivateKeyInfo
+	if _, err := asn1.Unmarshal(der, &info); err != nil {
+		return nil, fmt.Errorf("could not parse encrypted PKCS #8 private key: %s", err)
+	}
+	if !info.Algorithm.Algorithm.Equal(oidPBES2) {
+		return nil, &UnsupportedKeyError{Format: fmt.Sprintf("encrypted PKCS #8 private key using %v, only PBES2 is supported", info.Algorithm.Algorithm)}
+	}
+	var params pbes2Params
+	if _, err := asn1.Unmarshal(info.Algorithm.Parameters.FullBytes, &params); err != nil {
+		return nil, fmt.Errorf("could not parse PBES2 parameters: %s", err)
+	}
+	if !params.KeyDerivationFunc.Algorithm.Equal(oidPBKDF2) {
+		return nil, &UnsupportedKeyError{Format: fmt.Sprintf("encrypted PKCS #8 private key using key derivation %v, only PBKDF2 is supported", params.KeyDerivationFunc.Algorithm)}
+	}
+	var kdf pbkdf2Params
+	if _, err := asn1.Unmarshal(params.KeyDerivationFunc.Parameters.FullBytes, &kdf); err != nil {
+		return nil, fmt.Errorf("could not parse PBKDF2 parameters: %s", err)
+	}
+
+	var prf func() hash.Hash
+	switch alg := kdf.PRF.Algorithm; {
+	case len(alg) == 0, alg.Equal(oidHMACSHA1):
+		prf = sha1.New
+	case alg.Equal(oidHMACSHA256):
+		prf = sha256.New
+	case alg.Equal(oidHMACSHA512):
+		prf = sha512.New
+	default:
+		return nil, &UnsupportedKeyError{Format: fmt.Sprintf("encrypted PKCS #8 private key using PRF %v", alg)}
+	}
+
+	var newCipher func([]byte) (cipher.Block, error)
+	var keyLen int
+	switch alg := params.EncryptionScheme.Algorithm; {
+	case alg.Equal(oidAES128CBC):
+		newCipher, keyLen = aes.NewCipher, 16
+	case alg.Equal(oidAES192CBC):
+		newCipher, keyLen = aes.NewCipher, 24
+	case alg.Equal(oidAES256CBC):
+		newCipher, keyLen = aes.NewCipher, 32
+	case alg.Equal(oidDESEDE3CBC):
+		newCipher, keyLen = des.NewTripleDESCipher, 24
+	default:
+		return nil, &UnsupportedKeyError{Format: fmt.Sprintf("encrypted PKCS #8 private key using cipher %v", alg)}
+	}
+	var iv []byte
+	if _, err := asn1.Unmarshal(params.EncryptionScheme.Parameters.FullBytes, &iv); err != nil {
+		return nil, fmt.Errorf("could not parse encryption IV: %s", err)
+	}
+
+	if kdf.IterationCount <= 0 {
+		return nil, errors.New("could not parse PBKDF2 parameters: invalid iteration count")
+	}
+	block, err := newCipher(pbkdf2Key(passphrase, kdf.Salt, kdf.IterationCount, keyLen, prf))
+	if err != nil {
+		return nil, err
+	}
+	if len(iv) != block.BlockSize() || len(info.EncryptedData) == 0 || len(info.EncryptedData)%block.BlockSize() != 0 {
+		return nil, errors.New("could not decrypt PKCS #8 private key: invalid IV or data length")
+	}
+	plain := make([]byte, len(info.EncryptedData))
+	cipher.NewCBCDecrypter(block, iv).CryptBlocks(plain, info.EncryptedData)
+
+	// Remove PKCS #7 padding, an invalid padding indicates an incorrect passphrase.
+	pad := int(plain[len(plain)-1])
+	if pad == 0 || pad > block.BlockSize() || !bytes.Equal(plain[len(plain)-pad:], bytes.Repeat([]byte{byte(pad)}, pad)) {
+		return nil, ErrIncorrectPassphrase
+	}
+	plain = plain[:len(plain)-pad]
+	if _, err := asn1.Unmarshal(plain, &asn1.RawValue{}); err != nil {
+		return nil, ErrIncorrectPassphrase
+	}
+	return plain, nil
+}
+
+// pbkdf2Key derives a key of keyLen bytes from password and salt using
+// PBKDF2, as defined in RFC 8018, with the HMAC of h as the PRF.
+func pbkdf2Key(password, salt []byte, iter, keyLen int, h func() hash.Hash) []byte {
+	prf := hmac.New(h, password)
+	var key, u []byte
+	for block := uint32(1); len(key) < keyLen; block++ {
+		prf.Reset()
+		prf.Write(salt)
+		prf.Write([]byte{byte(block >> 24), byte(block >> 16), byte(block >> 8), byte(block)})
+		u = prf.Sum(u[:0])
+		t := bytes.Clone(u)
+		for i := 1; i < iter; i++ {
+			prf.Reset()
+			prf.Write(u)
+			u = prf.Sum(u[:0])
+			for j := range t {
+				t[j] ^= u[j]
+			}
+		}
+		key = append(key, t...)
+	}
+	return key[:keyLen]
+}
@@ -0,0 +1,159 @@
+package ghinstallation
+
+import (
+	"bytes"
+	"crypto/rsa"
+	"encoding/pem"
+	"fmt"
+	"io/fs"
+	"os"
+	"runtime"
+	"sort"
+)
+
+// minKeyBits is the minimum size of RSA keys accepted from key files.
+const minKeyBits = 2048
+
+// InsecureKeyFileError is returned when a private key file is readable by
+// its group or other users.
+type InsecureKeyFileError struct {
+	Path string
+	Mode fs.FileMode
+}
+
+func (e *InsecureKeyFileError) Error() string {
+	return fmt.Sprintf("private key file %s has insecure permissions %v, it must not be readable by group or others (chmod 600)", e.Path, e.Mode.Perm())
+}
+
+// WeakKeyError is returned when a private key file contains an RSA key
+// smaller than 2048 bits.
+type WeakKeyError struct {
+	Path string
+	Bits int
+}
+
+func (e *WeakKeyError) Error() string {
+	return fmt.Sprintf("private key in %s is %d bits, at least %d bits are required", e.Path, e.Bits, minKeyBits)
+}
+
+// UnexpectedPEMHeadersError is returned when a private key file contains PEM
+// headers or text other than the key, which may indicate the file was
+// exported with unintended metadata. With AllowUnexpectedPEMHeaders, it is
+// passed to the handler set with WithKeyFileWarnings instead.
+type UnexpectedPEMHeadersError struct {
+	Path    string
+	Headers []string
+}
+
+func (e *UnexpectedPEMHeadersError) Error() string {
+	return fmt.Sprintf("private key file %s contains unexpected PEM headers %q", e.Path, e.Headers)
+}
+
+// KeyFileOption configures the safety checks applied when loading a private
+// key from file, and the passphrase of an encrypted key. By default, files
+// readable by group or others, RSA keys smaller than 2048 bits and files with
+// unexpected PEM headers are rejected.
+type KeyFileOption func(*keyFileChecks)
+
+type keyFileChecks struct {
+	allowInsecurePermissions bool
+	allowWeakKeys            bool
+	allowPEMHeaders          bool
+	passphrase               []byte
+	warn                     func(error)
+}
+
+// AllowInsecureKeyFilePermissions disables the check that the key file is not
+// readable by group or others, for environments where permissions cannot be
+// controlled.
+func AllowInsecureKeyFilePermissions() KeyFileOption {
+	return func(c *keyFileChecks) { c.allowInsecurePermissions = true }
+}
+
+// AllowWeakKeys disables the check that the RSA key is at least 2048 bits.
+func AllowWeakKeys() KeyFileOption {
+	return func(c *keyFileChecks) { c.allowWeakKeys = true }
+}
+
+// AllowUnexpectedPEMHeaders disables the check that the key file contains
+// only the key, reporting any *UnexpectedPEMHeadersError to the handler set
+// with WithKeyFileWarnings instead.
+func AllowUnexpectedPEMHeaders() KeyFileOption {
+	return func(c *keyFileChecks) { c.allowPEMHeaders = true }
+}
+
+// WithPassphrase sets the passphrase used to decrypt an encrypted private
+// key, see ParsePrivateKey.
+func WithPassphrase(passphrase []byte) KeyFileOption {
+	return func(c *keyFileChecks) { c.passphrase = passphrase }
+}
+
+// WithKeyFileWarnings sets the handler for warnings about checks disabled by
+// other options, such as the *UnexpectedPEMHeadersError allowed by
+// AllowUnexpectedPEMHeaders. Warnings are discarded by default.
+func WithKeyFileWarnings(warn func(error)) KeyFileOption {
+	return func(c *keyFileChecks) { c.warn = warn }
+}
+
+// loadKeyFile reads and parses the private key in path, applying the checks
+// configured by opts.
+func loadKeyFile(path string, opts []KeyFileOption) (*rsa.PrivateKey, error) {
+	var checks keyFileChecks
+	for _, opt := range opts {
+		opt(&checks)
+	}
+
+	if !checks.allowInsecurePermissions && runtime.GOOS != "windows" {
+		fi, err := os.Stat(path)
+		if err != nil {
+			return nil, fmt.Errorf("could not read private key: %s", err)
+		}
+		if fi.Mode().Perm()&0o044 != 0 {
+			return nil, &InsecureKeyFileError{Path: path, Mode: fi.Mode()}
+		}
+	}
+
+	privateKey, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("could not read private key: %s", err)
+	}
+	if headers := unexpectedPEMHeaders(privateKey); len(headers) > 0 {
+		herr := &UnexpectedPEMHeadersError{Path: path, Headers: headers}
+		if !checks.allowPEMHeaders {
+			return nil, herr
+		}
+		if checks.warn != nil {
+			checks.warn(herr)
+		}
+	}
+
+	key, err := ParsePrivateKey(privateKey, checks.passphrase)
+	if err != nil {
+		return nil, fmt.Errorf("could not parse private key: %w", err)
+	}
+	if bits := key.N.BitLen(); !checks.allowWeakKeys && bits < minKeyBits {
+		return nil, &WeakKeyError{Path: path, Bits: bits}
+	}
+	return key, nil
+}
+
+// unexpectedPEMHeaders returns the headers of the first PEM block in data,
+// other than those describing encryption, and whether there is text before
+// the block, such as the "Bag Attributes" written by OpenSSL.
+func unexpectedPEMHeaders(data []byte) []string {
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil
+	}
+	var headers []string
+	for k := range block.Headers {
+		if k != "Proc-Type" && k != "DEK-Info" {
+			headers = append(headers, k)
+		}
+	}
+	sort.Strings(headers)
+	if i := bytes.Index(data, []byte("-----BEGIN ")); i > 0 && len(bytes.TrimSpace(data[:i])) > 0 {
+		headers = append(headers, "text before PEM block")
+	}
+	return headers
+}
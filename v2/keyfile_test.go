@@ -0,0 +1,124 @@
+package ghinstallation
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
+	"net/http"
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+)
+
+func writeKeyFile(t *testing.T, data []byte, perm os.FileMode) string {
+	file := filepath.Join(t.TempDir(), "key.pem")
+	if err := os.WriteFile(file, data, perm); err != nil {
+		t.Fatal(err)
+	}
+	// WriteFile's permissions are subject to umask.
+	if err := os.Chmod(file, perm); err != nil {
+		t.Fatal(err)
+	}
+	return file
+}
+
+func TestKeyFileChecks_permissions(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("file permissions are not checked on Windows")
+	}
+	for _, perm := range []os.FileMode{0o640, 0o604, 0o644} {
+		file := writeKeyFile(t, key, perm)
+		_, err := NewKeyFromFile(&http.Transport{}, appID, installationID, file)
+		var perr *InsecureKeyFileError
+		if !errors.As(err, &perr) {
+			t.Errorf("mode %v: error = %v, want InsecureKeyFileError", perm, err)
+		}
+		if _, err := NewKeyFromFile(&http.Transport{}, appID, installationID, file, AllowInsecureKeyFilePermissions()); err != nil {
+			t.Errorf("mode %v: unexpected error with override: %v", perm, err)
+		}
+	}
+	for _, perm := range []os.FileMode{0o600, 0o400} {
+		if _, err := NewKeyFromFile(&http.Transport{}, appID, installationID, writeKeyFile(t, key, perm)); err != nil {
+			t.Errorf("mode %v: unexpected error: %v", perm, err)
+		}
+	}
+}
+
+func TestKeyFileChecks_weakKey(t *testing.T) {
+	weak, err := rsa.GenerateKey(rand.Reader, 1024)
+	if err != nil {
+		t.Fatal(err)
+	}
+	file := writeKeyFile(t, pem.EncodeToMemory(&pem.Block{Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(weak)}), 0o600)
+
+	_, err = NewAppsTransportKeyFromFile(&http.Transport{}, appID, file)
+	var werr *WeakKeyError
+	if !errors.As(err, &werr) || werr.Bits != 1024 {
+		t.Fatalf("error = %v, want WeakKeyError for 1024 bits", err)
+	}
+	if _, err := NewAppsTransportKeyFromFile(&http.Transport{}, appID, file, AllowWeakKeys()); err != nil {
+		t.Fatalf("unexpected error with override: %v", err)
+	}
+}
+
+func TestKeyFileChecks_headers(t *testing.T) {
+	block, _ := pem.Decode(key)
+	block.Headers = map[string]string{"Comment": "exported from vault"}
+	withHeaders := append([]byte("Bag Attributes\n    localKeyID: 01\n"), pem.EncodeToMemory(block)...)
+
+	tests := []struct {
+		name string
+		data []byte
+		want []string
+	}{
+		{name: "plain", data: key},
+		{name: "headers", data: withHeaders, want: []string{"Comment", "text before PEM block"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			file := writeKeyFile(t, tt.data, 0o600)
+			var herr *UnexpectedPEMHeadersError
+			_, err := NewAppsTransportKeyFromFile(&http.Transport{}, appID, file)
+			if tt.want == nil && err != nil {
+				t.Fatal(err)
+			}
+			if tt.want != nil && !errors.As(err, &herr) {
+				t.Fatalf("error = %v, want UnexpectedPEMHeadersError", err)
+			}
+
+			var warnings []error
+			_, err = NewAppsTransportKeyFromFile(&http.Transport{}, appID, file, AllowUnexpectedPEMHeaders(), WithKeyFileWarnings(func(err error) {
+				warnings = append(warnings, err)
+			}))
+			if err != nil {
+				t.Fatalf("unexpected error with override: %v", err)
+			}
+			if tt.want == nil {
+				if len(warnings) != 0 {
+					t.Errorf("unexpected warnings: %v", warnings)
+				}
+				return
+			}
+			if len(warnings) != 1 || !errors.As(warnings[0], &herr) {
+				t.Fatalf("warnings = %v, want UnexpectedPEMHeadersError", warnings)
+			}
+			if len(herr.Headers) != len(tt.want) || herr.Headers[0] != tt.want[0] || herr.Headers[1] != tt.want[1] {
+				t.Errorf("headers = %q, want %q", herr.Headers, tt.want)
+			}
+		})
+	}
+}
+
+func TestKeyFilePassphrase(t *testing.T) {
+	file := writeKeyFile(t, readTestdata(t, "pkcs1-encrypted.pem"), 0o600)
+
+	if _, err := NewAppsTransportKeyFromFile(&http.Transport{}, appID, file); !errors.Is(err, ErrPassphraseRequired) {
+		t.Fatalf("error = %v, want ErrPassphraseRequired", err)
+	}
+	if _, err := NewAppsTransportKeyFromFile(&http.Transport{}, appID, file, WithPassphrase([]byte("hunter2"))); err != nil {
+		t.Fatalf("unexpected error with passphrase: %v", err)
+	}
+}
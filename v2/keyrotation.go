@@ -0,0 +1,90 @@
+package ghinstallation
+
+import (
+	"context"
+	"crypto"
+	"crypto/rsa"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// defaultKeyWatchInterval is the interval used by WatchKeyFile and
+// WatchKeySource when none is given.
+const defaultKeyWatchInterval = time.Minute
+
+// RotateKey atomically replaces the signer used to sign JWTs. The replaced
+// signer is kept until the next rotation, and is used as a fallback when
+// GitHub rejects a JWT signed by the new signer, so keys can be rotated
+// without downtime regardless of whether the new key is registered with
+// GitHub before or after the rotation.
+//
+// If signer has the same public key as the current signer, the key has not
+// changed and RotateKey does nothing, so the previous signer is kept.
+func (t *AppsTransport) RotateKey(signer crypto.Signer) error {
+	if k, ok := signer.(*rsa.PrivateKey); signer == nil || ok && k == nil {
+		return errors.New("signer must not be nil")
+	}
+	pub, ok := signer.Public().(*rsa.PublicKey)
+	if !ok {
+		return fmt.Errorf("signer public key must be *rsa.PublicKey, got %T", signer.Public())
+	}
+	t.keyMu.Lock()
+	defer t.keyMu.Unlock()
+	if t.signer != nil && pub.Equal(t.signer.Public()) {
+		return nil
+	}
+	t.prevSigner, t.signer = t.signer, signer
+	return nil
+}
+
+// ReloadKeyFile reads the private key from privateKeyFile and rotates to it
+// if it has changed, see RotateKey. The file is checked as by
+// NewAppsTransportKeyFromFile, configured by opts.
+func (t *AppsTransport) ReloadKeyFile(privateKeyFile string, opts ...KeyFileOption) error {
+	return t.refreshKey(context.Background(), FileKeySource{Path: privateKeyFile, Options: opts})
+}
+
+// WatchKeyFile re-reads privateKeyFile every interval, or every minute if
+// interval is not positive, and rotates to the key it contains whenever it
+// changes, see RotateKey. This allows a key mounted from a secret store to be
+// rotated without a restart.
+//
+// WatchKeyFile blocks until ctx is done, and is typically run in its own
+// goroutine. Errors reading or parsing the file are passed to onError, if not
+// nil, and the current key remains in use. The file is checked as by
+// NewAppsTransportKeyFromFile, configured by opts.
+func (t *AppsTransport) WatchKeyFile(ctx context.Context, privateKeyFile string, interval time.Duration, onError func(error), opts ...KeyFileOption) {
+	t.watchKey(ctx, FileKeySource{Path: privateKeyFile, Options: opts}, interval, onError)
+}
+
+// watchKey calls refreshKey with src every interval until ctx is done.
+func (t *AppsTransport) watchKey(ctx context.Context, src KeySource, interval time.Duration, onError func(error)) {
+	if interval <= 0 {
+		interval = defaultKeyWatchInterval
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+		// An invalid key may be partially written, so the current key is
+		// kept and the key is fetched again on the next tick.
+		if err := t.refreshKey(ctx, src); err != nil && onError != nil {
+			onError(err)
+		}
+	}
+}
+
+// refreshKey fetches the private key from src, and rotates to it if it is
+// not the current key.
+func (t *AppsTransport) refreshKey(ctx context.Context, src KeySource) error {
+	key, err := fetchKey(ctx, src)
+	if err != nil {
+		return err
+	}
+	return t.RotateKey(key)
+}
@@ -0,0 +1,243 @@
+package ghinstallation
+
+import (
+	"context"
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
+	"net/http"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+func generateKeyPEM(t *testing.T) (*rsa.PrivateKey, []byte) {
+	k, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return k, pem.EncodeToMemory(&pem.Block{Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(k)})
+}
+
+// acceptKey returns a RoundTripper which responds 401 unless the JWT is
+// signed by accepted.
+func acceptKey(t *testing.T, accepted *rsa.PrivateKey, attempts *int) RoundTrip {
+	return RoundTrip{
+		rt: func(req *http.Request) (*http.Response, error) {
+			*attempts++
+			token := strings.Fields(req.Header.Get("Authorization"))[1]
+			_, err := jwt.NewParser().Parse(token, func(*jwt.Token) (interface{}, error) {
+				return accepted.Public(), nil
+			})
+			status := http.StatusOK
+			if err != nil {
+				status = http.StatusUnauthorized
+			}
+			return &http.Response{StatusCode: status, Body: http.NoBody, Request: req}, nil
+		},
+	}
+}
+
+func TestRotateKey_fallback(t *testing.T) {
+	oldKey, err := jwt.ParseRSAPrivateKeyFromPEM(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	newKey, _ := generateKeyPEM(t)
+
+	var attempts int
+	tr := NewAppsTransportFromPrivateKey(acceptKey(t, oldKey, &attempts), appID, oldKey)
+	if err := tr.RotateKey(newKey); err != nil {
+		t.Fatal(err)
+	}
+
+	// GitHub only knows the old key, so the request falls back to it.
+	req, _ := http.NewRequest(http.MethodPost, "http://example.com", strings.NewReader("body"))
+	resp, err := tr.RoundTrip(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.StatusCode != http.StatusOK || attempts != 2 {
+		t.Errorf("got status %d after %d attempts, want 200 after 2", resp.StatusCode, attempts)
+	}
+
+	// GitHub knows the new key, so no fallback is required.
+	attempts = 0
+	tr.tr = acceptKey(t, newKey, &attempts)
+	req, _ = http.NewRequest(http.MethodGet, "http://example.com", nil)
+	resp, err = tr.RoundTrip(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.StatusCode != http.StatusOK || attempts != 1 {
+		t.Errorf("got status %d after %d attempts, want 200 after 1", resp.StatusCode, attempts)
+	}
+
+	// Without a previous key, there is no fallback.
+	attempts = 0
+	tr = NewAppsTransportFromPrivateKey(acceptKey(t, oldKey, &attempts), appID, newKey)
+	req, _ = http.NewRequest(http.MethodGet, "http://example.com", nil)
+	resp, err = tr.RoundTrip(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.StatusCode != http.StatusUnauthorized || attempts != 1 {
+		t.Errorf("got status %d after %d attempts, want 401 after 1", resp.StatusCode, attempts)
+	}
+}
+
+func TestWatchKeyFile(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "key.pem")
+	if err := os.WriteFile(file, key, 0o600); err != nil {
+		t.Fatal(err)
+	}
+	tr, err := NewAppsTransportKeyFromFile(&http.Transport{}, appID, file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	oldSigner := tr.signer
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	errs := make(chan error, 1)
+	go tr.WatchKeyFile(ctx, file, 10*time.Millisecond, func(err error) {
+		select {
+		case errs <- err:
+		default:
+		}
+	})
+
+	// A partially written file is reported and ignored.
+	if err := os.WriteFile(file, []byte("-----BEGIN RSA"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case <-errs:
+	case <-time.After(5 * time.Second):
+		t.Fatal("expected error for invalid key file")
+	}
+
+	newKey, newPEM := generateKeyPEM(t)
+	if err := os.WriteFile(file, newPEM, 0o600); err != nil {
+		t.Fatal(err)
+	}
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		tr.keyMu.RLock()
+		signer, prevSigner := tr.signer, tr.prevSigner
+		tr.keyMu.RUnlock()
+		if newKey.Equal(signer) {
+			if prevSigner != oldSigner {
+				t.Error("previous signer was not kept")
+			}
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("key was not reloaded")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestRotateKey_nil(t *testing.T) {
+	oldKey, err := jwt.ParseRSAPrivateKeyFromPEM(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tr := NewAppsTransportFromPrivateKey(&http.Transport{}, appID, oldKey)
+	var nilKey *rsa.PrivateKey
+	for _, signer := range []crypto.Signer{nil, nilKey} {
+		if err := tr.RotateKey(signer); err == nil {
+			t.Errorf("RotateKey(%#v): expected error", signer)
+		}
+	}
+	if tr.signer != crypto.Signer(oldKey) {
+		t.Error("signer replaced by a failed rotation")
+	}
+}
+
+func TestReloadKeyFile_checks(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("file permissions are not checked on Windows")
+	}
+	oldKey, err := jwt.ParseRSAPrivateKeyFromPEM(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tr := NewAppsTransportFromPrivateKey(&http.Transport{}, appID, oldKey)
+
+	newKey, newPEM := generateKeyPEM(t)
+	file := writeKeyFile(t, newPEM, 0o644)
+	var perr *InsecureKeyFileError
+	if err := tr.ReloadKeyFile(file); !errors.As(err, &perr) {
+		t.Errorf("error = %v, want InsecureKeyFileError", err)
+	}
+	if tr.signer != crypto.Signer(oldKey) {
+		t.Error("signer replaced by a rejected key file")
+	}
+	if err := tr.ReloadKeyFile(file, AllowInsecureKeyFilePermissions()); err != nil {
+		t.Fatal(err)
+	}
+	if !newKey.Equal(tr.signer) {
+		t.Error("key was not reloaded with override")
+	}
+
+	weak, err := rsa.GenerateKey(rand.Reader, 1024)
+	if err != nil {
+		t.Fatal(err)
+	}
+	file = writeKeyFile(t, pem.EncodeToMemory(&pem.Block{Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(weak)}), 0o600)
+	var werr *WeakKeyError
+	if err := tr.ReloadKeyFile(file); !errors.As(err, &werr) {
+		t.Errorf("error = %v, want WeakKeyError", err)
+	}
+	if !newKey.Equal(tr.signer) {
+		t.Error("signer replaced by a weak key")
+	}
+}
+
+func TestRefreshKey_concurrent(t *testing.T) {
+	oldKey, err := jwt.ParseRSAPrivateKeyFromPEM(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tr := NewAppsTransportFromPrivateKey(&http.Transport{}, appID, oldKey)
+	newKey, newPEM := generateKeyPEM(t)
+	src := KeySourceFunc(func(context.Context) ([]byte, error) { return newPEM, nil })
+
+	// Concurrent refreshes of the same key rotate once, keeping the old key.
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if err := tr.refreshKey(context.Background(), src); err != nil {
+				t.Error(err)
+			}
+		}()
+	}
+	wg.Wait()
+	if !newKey.Equal(tr.signer) {
+		t.Error("key was not rotated")
+	}
+	if !oldKey.Equal(tr.prevSigner) {
+		t.Error("previous key was not kept")
+	}
+}
+
+func TestWatchKeyFile_interval(t *testing.T) {
+	tr := NewAppsTransportFromPrivateKey(&http.Transport{}, appID, nil)
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	// A non-positive interval uses the default rather than panicking.
+	tr.WatchKeyFile(ctx, filepath.Join(t.TempDir(), "key.pem"), 0, nil)
+}
@@ -0,0 +1,197 @@
+package ghinstallation
+
+import (
+	"bytes"
+	"context"
+	"crypto/rsa"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// KeySource provides a GitHub App's private key material, in any format
+// supported by ParsePrivateKey. Sources are fetched lazily, when the key is
+// first required, and again whenever the key is refreshed, see
+// AppsTransport.RefreshKey.
+type KeySource interface {
+	// Key returns the current private key material.
+	Key(ctx context.Context) ([]byte, error)
+}
+
+// KeySourceFunc is an adapter to allow the use of ordinary functions as a
+// KeySource.
+type KeySourceFunc func(ctx context.Context) ([]byte, error)
+
+// Key implements KeySource.
+func (f KeySourceFunc) Key(ctx context.Context) ([]byte, error) {
+	return f(ctx)
+}
+
+// EnvKeySource reads the private key from an environment variable.
+type EnvKeySource struct {
+	Name string // Name is the name of the environment variable
+}
+
+// Key implements KeySource.
+func (s EnvKeySource) Key(context.Context) ([]byte, error) {
+	v, ok := os.LookupEnv(s.Name)
+	if !ok || v == "" {
+		return nil, fmt.Errorf("environment variable %s is not set", s.Name)
+	}
+	return []byte(v), nil
+}
+
+// FileKeySource reads the private key from a file. The file is checked as
+// by NewAppsTransportKeyFromFile, configured by Options.
+type FileKeySource struct {
+	Path    string          // Path is the path to the private key file
+	Options []KeyFileOption // Options configures the checks applied to the file, and its passphrase
+}
+
+// Key implements KeySource.
+func (s FileKeySource) Key(context.Context) ([]byte, error) {
+	return os.ReadFile(s.Path)
+}
+
+func (s FileKeySource) loadKey(context.Context) (*rsa.PrivateKey, error) {
+	return loadKeyFile(s.Path, s.Options)
+}
+
+// EncryptedKeySource decrypts the encrypted private key provided by Source
+// with Passphrase. To load an encrypted key file, use
+// NewAppsTransportKeyFromFile with WithPassphrase instead.
+type EncryptedKeySource struct {
+	Source     KeySource
+	Passphrase []byte
+}
+
+// Key implements KeySource, returning the encrypted key material.
+func (s EncryptedKeySource) Key(ctx context.Context) ([]byte, error) {
+	return s.Source.Key(ctx)
+}
+
+func (s EncryptedKeySource) loadKey(ctx context.Context) (*rsa.PrivateKey, error) {
+	privateKey, err := s.Source.Key(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("could not read private key: %w", err)
+	}
+	key, err := ParsePrivateKey(privateKey, s.Passphrase)
+	if err != nil {
+		return nil, fmt.Errorf("could not parse private key: %w", err)
+	}
+	return key, nil
+}
+
+// CommandKeySource runs a command, such as a secrets manager CLI, which
+// prints the private key to stdout.
+type CommandKeySource struct {
+	Name string   // Name is the program to run, resolved using PATH if it contains no path separators
+	Args []string // Args are the arguments passed to the program
+}
+
+// Key implements KeySource.
+func (s CommandKeySource) Key(ctx context.Context) ([]byte, error) {
+	out, err := exec.CommandContext(ctx, s.Name, s.Args...).Output()
+	if err != nil {
+		var exitErr *exec.ExitError
+		if errors.As(err, &exitErr) && len(exitErr.Stderr) > 0 {
+			return nil, fmt.Errorf("command %s failed: %s: %s", s.Name, err, bytes.TrimSpace(exitErr.Stderr))
+		}
+		return nil, fmt.Errorf("command %s failed: %s", s.Name, err)
+	}
+	return out, nil
+}
+
+// SecretMountKeySource reads the private key from a directory-style secret
+// mount, such as a Kubernetes Secret volume, where each key of the secret is
+// a file in the directory and updates are made by atomically swapping the
+// directory's contents.
+type SecretMountKeySource struct {
+	Dir  string // Dir is the directory the secret is mounted at
+	Name string // Name is the file containing the private key, optional if the secret has a single file
+}
+
+// Key implements KeySource.
+func (s SecretMountKeySource) Key(context.Context) ([]byte, error) {
+	name := s.Name
+	if name == "" {
+		entries, err := os.ReadDir(s.Dir)
+		if err != nil {
+			return nil, err
+		}
+		var files []string
+		for _, e := range entries {
+			// Kubernetes mounts contain hidden ..data and timestamped
+			// directories used to swap the contents atomically.
+			if strings.HasPrefix(e.Name(), ".") || e.IsDir() {
+				continue
+			}
+			files = append(files, e.Name())
+		}
+		if len(files) != 1 {
+			return nil, fmt.Errorf("secret mount %s contains %d files, set Name to select the private key", s.Dir, len(files))
+		}
+		name = files[0]
+	}
+	return os.ReadFile(filepath.Join(s.Dir, name))
+}
+
+// NewAppsTransportFromKeySource returns an AppsTransport using the private key
+// provided by src. The key is not fetched until it is first required, and
+// can be refreshed with RefreshKey or WatchKeySource.
+func NewAppsTransportFromKeySource(tr http.RoundTripper, app AppIdentity, src KeySource) (*AppsTransport, error) {
+	if err := app.Validate(); err != nil {
+		return nil, err
+	}
+	t := newAppsTransport(tr, app, nil)
+	t.keySource = src
+	return t, nil
+}
+
+// RefreshKey fetches the private key from the AppsTransport's KeySource, and
+// rotates to it if it has changed, see RotateKey.
+func (t *AppsTransport) RefreshKey(ctx context.Context) error {
+	if t.keySource == nil {
+		return errors.New("AppsTransport has no KeySource")
+	}
+	return t.refreshKey(ctx, t.keySource)
+}
+
+// WatchKeySource calls RefreshKey every interval, or every minute if interval
+// is not positive, until ctx is done. See WatchKeyFile.
+func (t *AppsTransport) WatchKeySource(ctx context.Context, interval time.Duration, onError func(error)) {
+	if t.keySource == nil {
+		if onError != nil {
+			onError(errors.New("AppsTransport has no KeySource"))
+		}
+		return
+	}
+	t.watchKey(ctx, t.keySource, interval, onError)
+}
+
+// keyLoader is implemented by KeySources which parse the private key
+// themselves, such as to decrypt it.
+type keyLoader interface {
+	loadKey(ctx context.Context) (*rsa.PrivateKey, error)
+}
+
+// fetchKey fetches and parses the private key from src.
+func fetchKey(ctx context.Context, src KeySource) (*rsa.PrivateKey, error) {
+	if l, ok := src.(keyLoader); ok {
+		return l.loadKey(ctx)
+	}
+	privateKey, err := src.Key(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("could not read private key: %w", err)
+	}
+	key, err := ParsePrivateKey(privateKey, nil)
+	if err != nil {
+		return nil, fmt.Errorf("could not parse private key: %w", err)
+	}
+	return key, nil
+}
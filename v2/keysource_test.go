@@ -0,0 +1,165 @@
+package ghinstallation
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+)
+
+func TestKeySources(t *testing.T) {
+	dir := t.TempDir()
+	file := filepath.Join(dir, "key.pem")
+	if err := os.WriteFile(file, key, 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	// Mimic a Kubernetes Secret volume.
+	mount := filepath.Join(dir, "mount")
+	data := filepath.Join(mount, "..2024_01_01_00_00_00.000000000")
+	if err := os.MkdirAll(data, 0o700); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(data, "private-key.pem"), key, 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Symlink(filepath.Base(data), filepath.Join(mount, "..data")); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Symlink(filepath.Join("..data", "private-key.pem"), filepath.Join(mount, "private-key.pem")); err != nil {
+		t.Fatal(err)
+	}
+
+	t.Setenv("GITHUB_APP_PRIVATE_KEY", base64.StdEncoding.EncodeToString(key))
+
+	tests := []struct {
+		name string
+		src  KeySource
+	}{
+		{name: "env", src: EnvKeySource{Name: "GITHUB_APP_PRIVATE_KEY"}},
+		{name: "file", src: FileKeySource{Path: file}},
+		{name: "secret mount", src: SecretMountKeySource{Dir: mount}},
+		{name: "secret mount with name", src: SecretMountKeySource{Dir: mount, Name: "private-key.pem"}},
+		{name: "func", src: KeySourceFunc(func(context.Context) ([]byte, error) { return key, nil })},
+	}
+	if runtime.GOOS != "windows" {
+		tests = append(tests, struct {
+			name string
+			src  KeySource
+		}{name: "command", src: CommandKeySource{Name: "cat", Args: []string{file}}})
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := fetchKey(context.Background(), tt.src); err != nil {
+				t.Fatal(err)
+			}
+		})
+	}
+}
+
+func TestKeySources_errors(t *testing.T) {
+	tests := []struct {
+		name string
+		src  KeySource
+	}{
+		{name: "unset env", src: EnvKeySource{Name: "GHINSTALLATION_UNSET_VARIABLE"}},
+		{name: "missing file", src: FileKeySource{Path: filepath.Join(t.TempDir(), "missing.pem")}},
+		{name: "failing command", src: CommandKeySource{Name: "false"}},
+		{name: "empty secret mount", src: SecretMountKeySource{Dir: t.TempDir()}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := fetchKey(context.Background(), tt.src); err == nil {
+				t.Fatal("expected error")
+			}
+		})
+	}
+}
+
+func TestNewAppsTransportFromKeySource(t *testing.T) {
+	var fetches int
+	current := key
+	src := KeySourceFunc(func(context.Context) ([]byte, error) {
+		fetches++
+		return current, nil
+	})
+
+	tr, err := NewAppsTransportFromKeySource(RoundTrip{
+		rt: func(req *http.Request) (*http.Response, error) {
+			return &http.Response{StatusCode: http.StatusOK, Body: http.NoBody}, nil
+		},
+	}, appID, src)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if fetches != 0 {
+		t.Fatal("key fetched before it was required")
+	}
+
+	for i := 0; i < 2; i++ {
+		req := httptest.NewRequest(http.MethodGet, "http://example.com", new(bytes.Buffer))
+		if _, err := tr.RoundTrip(req); err != nil {
+			t.Fatalf("error calling RoundTrip: %v", err)
+		}
+	}
+	if fetches != 1 {
+		t.Errorf("key fetched %d times, want 1", fetches)
+	}
+
+	// Refreshing an unchanged key does not rotate.
+	oldSigner := tr.signer
+	if err := tr.RefreshKey(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if tr.signer != oldSigner || tr.prevSigner != nil {
+		t.Error("unchanged key was rotated")
+	}
+
+	newKey, newPEM := generateKeyPEM(t)
+	current = newPEM
+	if err := tr.RefreshKey(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if !newKey.Equal(tr.signer) || tr.prevSigner != oldSigner {
+		t.Error("changed key was not rotated")
+	}
+}
+
+func TestNewAppsTransportFromKeySource_error(t *testing.T) {
+	wantErr := errors.New("secret manager unavailable")
+	tr, err := NewAppsTransportFromKeySource(&http.Transport{}, appID, KeySourceFunc(func(context.Context) ([]byte, error) {
+		return nil, wantErr
+	}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	req := httptest.NewRequest(http.MethodGet, "http://example.com", new(bytes.Buffer))
+	if _, err := tr.RoundTrip(req); !errors.Is(err, wantErr) {
+		t.Fatalf("RoundTrip error = %v, want %v", err, wantErr)
+	}
+}
+
+func TestEncryptedKeySource(t *testing.T) {
+	data := readTestdata(t, "pkcs1-encrypted.pem")
+	src := KeySourceFunc(func(context.Context) ([]byte, error) { return data, nil })
+
+	if _, err := fetchKey(context.Background(), src); !errors.Is(err, ErrPassphraseRequired) {
+		t.Fatalf("error = %v, want ErrPassphraseRequired", err)
+	}
+	if _, err := fetchKey(context.Background(), EncryptedKeySource{Source: src, Passphrase: []byte("wrong")}); !errors.Is(err, ErrIncorrectPassphrase) {
+		t.Fatalf("error = %v, want ErrIncorrectPassphrase", err)
+	}
+	atr, err := NewAppsTransportFromKeySource(&http.Transport{}, appID, EncryptedKeySource{Source: src, Passphrase: []byte("hunter2")})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := atr.RefreshKey(context.Background()); err != nil {
+		t.Fatalf("RefreshKey: %v", err)
+	}
+}
@@ -0,0 +1,20 @@
+module github.com/pagerguild/ghinstallation/v2/kmssigner
+
+go 1.23.2
+
+require (
+	github.com/aws/aws-sdk-go-v2 v1.41.1
+	github.com/aws/aws-sdk-go-v2/service/kms v1.50.0
+	github.com/golang-jwt/jwt/v5 v5.2.1
+	github.com/pagerguild/ghinstallation/v2 v2.0.0-00010101000000-000000000000
+)
+
+require (
+	github.com/aws/aws-sdk-go-v2/internal/configsources v1.4.17 // indirect
+	github.com/aws/aws-sdk-go-v2/internal/endpoints/v2 v2.7.17 // indirect
+	github.com/aws/smithy-go v1.24.0 // indirect
+	github.com/google/go-github/v69 v69.0.0 // indirect
+	github.com/google/go-querystring v1.1.0 // indirect
+)
+
+replace github.com/pagerguild/ghinstallation/v2 => ../
@@ -0,0 +1,123 @@
+// Package kmssigner provides a crypto.Signer backed by an RSA key held in AWS
+// KMS, for use with ghinstallation.NewAppsTransportFromSigner.
+//
+// The KMS key must be an asymmetric RSA key with key usage SIGN_VERIFY, and
+// is used with the RSASSA_PKCS1_V1_5_SHA_256 signing algorithm.
+package kmssigner
+
+import (
+	"context"
+	"crypto"
+	"crypto/rsa"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"io"
+	"slices"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/service/kms"
+	"github.com/aws/aws-sdk-go-v2/service/kms/types"
+	"github.com/pagerguild/ghinstallation/v2"
+)
+
+// defaultTimeout bounds calls to Sign, which has no context.
+const defaultTimeout = 10 * time.Second
+
+// Client is the subset of *kms.Client used by Signer.
+type Client interface {
+	GetPublicKey(ctx context.Context, params *kms.GetPublicKeyInput, optFns ...func(*kms.Options)) (*kms.GetPublicKeyOutput, error)
+	Sign(ctx context.Context, params *kms.SignInput, optFns ...func(*kms.Options)) (*kms.SignOutput, error)
+}
+
+// Signer is a crypto.Signer which signs using an RSA key in AWS KMS.
+//
+// Signer implements ghinstallation.ContextSigner, so the context of the
+// request being authenticated is propagated to KMS.
+type Signer struct {
+	// MaxAttempts is the maximum number of attempts for each call to KMS,
+	// including retries. Zero uses the client's configured retryer.
+	MaxAttempts int
+	// Timeout bounds calls to Sign, which has no context, defaults to 10
+	// seconds. SignContext uses its context's deadline instead.
+	Timeout time.Duration
+
+	client Client
+	keyID  string
+	pub    *rsa.PublicKey
+}
+
+var _ ghinstallation.ContextSigner = &Signer{}
+
+// New returns a Signer using the KMS key keyID, which may be a key ID, key ARN,
+// alias name or alias ARN. The key's public key is fetched from KMS and the
+// key is checked to be suitable for RS256 signatures.
+func New(ctx context.Context, client Client, keyID string) (*Signer, error) {
+	out, err := client.GetPublicKey(ctx, &kms.GetPublicKeyInput{KeyId: &keyID})
+	if err != nil {
+		return nil, fmt.Errorf("kmssigner: could not get public key for %q: %w", keyID, err)
+	}
+	if out.KeyUsage != types.KeyUsageTypeSignVerify {
+		return nil, fmt.Errorf("kmssigner: key %q has usage %q, want %q", keyID, out.KeyUsage, types.KeyUsageTypeSignVerify)
+	}
+	if !slices.Contains(out.SigningAlgorithms, types.SigningAlgorithmSpecRsassaPkcs1V15Sha256) {
+		return nil, fmt.Errorf("kmssigner: key %q does not support %q", keyID, types.SigningAlgorithmSpecRsassaPkcs1V15Sha256)
+	}
+	pub, err := x509.ParsePKIXPublicKey(out.PublicKey)
+	if err != nil {
+		return nil, fmt.Errorf("kmssigner: could not parse public key for %q: %w", keyID, err)
+	}
+	rsaPub, ok := pub.(*rsa.PublicKey)
+	if !ok {
+		return nil, fmt.Errorf("kmssigner: key %q is %T, want *rsa.PublicKey", keyID, pub)
+	}
+	return &Signer{
+		client: client,
+		keyID:  keyID,
+		pub:    rsaPub,
+	}, nil
+}
+
+// Public implements crypto.Signer.
+func (s *Signer) Public() crypto.PublicKey {
+	return s.pub
+}
+
+// Sign implements crypto.Signer, see SignContext.
+func (s *Signer) Sign(_ io.Reader, digest []byte, opts crypto.SignerOpts) ([]byte, error) {
+	timeout := s.Timeout
+	if timeout <= 0 {
+		timeout = defaultTimeout
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	return s.SignContext(ctx, digest, opts)
+}
+
+// SignContext implements ghinstallation.ContextSigner. Only PKCS #1 v1.5
+// signatures of SHA-256 digests are supported, as required for RS256 JWTs.
+func (s *Signer) SignContext(ctx context.Context, digest []byte, opts crypto.SignerOpts) ([]byte, error) {
+	if opts.HashFunc() != crypto.SHA256 {
+		return nil, fmt.Errorf("kmssigner: unsupported hash function %v", opts.HashFunc())
+	}
+	if _, ok := opts.(*rsa.PSSOptions); ok {
+		return nil, errors.New("kmssigner: RSA-PSS signatures are not supported")
+	}
+
+	var optFns []func(*kms.Options)
+	if s.MaxAttempts > 0 {
+		optFns = append(optFns, func(o *kms.Options) {
+			o.RetryMaxAttempts = s.MaxAttempts
+		})
+	}
+	out, err := s.client.Sign(ctx, &kms.SignInput{
+		KeyId:            &s.keyID,
+		Message:          digest,
+		MessageType:      types.MessageTypeDigest,
+		SigningAlgorithm: types.SigningAlgorithmSpecRsassaPkcs1V15Sha256,
+	}, optFns...)
+	if err != nil {
+		return nil, fmt.Errorf("kmssigner: could not sign with %q: %w", s.keyID, err)
+	}
+	return out.Signature, nil
+}
@@ -0,0 +1,223 @@
+package kmssigner
+
+import (
+	"bytes"
+	"context"
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/aws/retry"
+	"github.com/aws/aws-sdk-go-v2/service/kms"
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/pagerguild/ghinstallation/v2"
+)
+
+const keyID = "alias/github-app"
+
+// emulator is a minimal local KMS, speaking the AWS JSON 1.1 protocol for
+// the GetPublicKey and Sign operations.
+type emulator struct {
+	key      *rsa.PrivateKey
+	keyUsage string
+	failures atomic.Int32 // failures is the number of Sign calls to fail before succeeding
+	signs    atomic.Int32 // signs is the number of Sign calls received
+}
+
+func (e *emulator) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	var in struct {
+		KeyId            string
+		Message          []byte
+		MessageType      string
+		SigningAlgorithm string
+	}
+	if err := json.NewDecoder(r.Body).Decode(&in); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if in.KeyId != keyID {
+		writeError(w, http.StatusBadRequest, "NotFoundException")
+		return
+	}
+
+	var out interface{}
+	switch r.Header.Get("X-Amz-Target") {
+	case "TrentService.GetPublicKey":
+		der, err := x509.MarshalPKIXPublicKey(e.key.Public())
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		out = map[string]interface{}{
+			"KeyId":             in.KeyId,
+			"KeySpec":           "RSA_2048",
+			"KeyUsage":          e.keyUsage,
+			"PublicKey":         der,
+			"SigningAlgorithms": []string{"RSASSA_PKCS1_V1_5_SHA_256", "RSASSA_PSS_SHA_256"},
+		}
+	case "TrentService.Sign":
+		e.signs.Add(1)
+		if e.failures.Add(-1) >= 0 {
+			writeError(w, http.StatusInternalServerError, "KMSInternalException")
+			return
+		}
+		if in.MessageType != "DIGEST" || in.SigningAlgorithm != "RSASSA_PKCS1_V1_5_SHA_256" {
+			writeError(w, http.StatusBadRequest, "ValidationException")
+			return
+		}
+		sig, err := rsa.SignPKCS1v15(rand.Reader, e.key, crypto.SHA256, in.Message)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		out = map[string]interface{}{
+			"KeyId":            in.KeyId,
+			"Signature":        sig,
+			"SigningAlgorithm": in.SigningAlgorithm,
+		}
+	default:
+		writeError(w, http.StatusBadRequest, "UnknownOperationException")
+		return
+	}
+	w.Header().Set("Content-Type", "application/x-amz-json-1.1")
+	json.NewEncoder(w).Encode(out)
+}
+
+func writeError(w http.ResponseWriter, status int, typ string) {
+	w.Header().Set("Content-Type", "application/x-amz-json-1.1")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(map[string]string{"__type": typ, "message": typ})
+}
+
+func newEmulator(t *testing.T, keyUsage string) (*emulator, *kms.Client) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	e := &emulator{key: key, keyUsage: keyUsage}
+	ts := httptest.NewServer(e)
+	t.Cleanup(ts.Close)
+
+	client := kms.New(kms.Options{
+		Region:       "us-east-1",
+		BaseEndpoint: aws.String(ts.URL),
+		Credentials:  aws.AnonymousCredentials{},
+		Retryer: retry.NewStandard(func(o *retry.StandardOptions) {
+			o.Backoff = retry.BackoffDelayerFunc(func(int, error) (time.Duration, error) { return 0, nil })
+		}),
+	})
+	return e, client
+}
+
+func TestSigner(t *testing.T) {
+	e, client := newEmulator(t, "SIGN_VERIFY")
+
+	s, err := New(context.Background(), client, keyID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !e.key.PublicKey.Equal(s.Public()) {
+		t.Fatal("public key does not match KMS key")
+	}
+
+	digest := sha256.Sum256([]byte("message"))
+	sig, err := s.Sign(nil, digest[:], crypto.SHA256)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := rsa.VerifyPKCS1v15(&e.key.PublicKey, crypto.SHA256, digest[:], sig); err != nil {
+		t.Fatalf("VerifyPKCS1v15: %v", err)
+	}
+}
+
+func TestSigner_retry(t *testing.T) {
+	e, client := newEmulator(t, "SIGN_VERIFY")
+
+	s, err := New(context.Background(), client, keyID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s.MaxAttempts = 3
+
+	e.failures.Store(2)
+	digest := sha256.Sum256([]byte("message"))
+	if _, err := s.Sign(nil, digest[:], crypto.SHA256); err != nil {
+		t.Fatalf("Sign with retries: %v", err)
+	}
+	if got := e.signs.Load(); got != 3 {
+		t.Errorf("Sign calls = %d, want 3", got)
+	}
+
+	e.signs.Store(0)
+	e.failures.Store(3)
+	if _, err := s.Sign(nil, digest[:], crypto.SHA256); err == nil {
+		t.Fatal("expected error once attempts are exhausted")
+	}
+	if got := e.signs.Load(); got != 3 {
+		t.Errorf("Sign calls = %d, want 3", got)
+	}
+}
+
+func TestSigner_keyUsage(t *testing.T) {
+	_, client := newEmulator(t, "ENCRYPT_DECRYPT")
+
+	if _, err := New(context.Background(), client, keyID); err == nil {
+		t.Fatal("expected error for key without SIGN_VERIFY usage")
+	}
+}
+
+func TestSigner_appsTransport(t *testing.T) {
+	e, client := newEmulator(t, "SIGN_VERIFY")
+
+	s, err := New(context.Background(), client, keyID)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	check := roundTripFunc(func(req *http.Request) (*http.Response, error) {
+		token := strings.Fields(req.Header.Get("Authorization"))[1]
+		_, err := jwt.NewParser(jwt.WithValidMethods([]string{"RS256"})).Parse(token, func(*jwt.Token) (interface{}, error) {
+			return e.key.Public(), nil
+		})
+		if err != nil {
+			t.Errorf("jwt parse: %v", err)
+		}
+		return nil, nil
+	})
+
+	tr, err := ghinstallation.NewAppsTransportFromSigner(check, "Iv1.0123456789abcdef", s)
+	if err != nil {
+		t.Fatal(err)
+	}
+	req := httptest.NewRequest(http.MethodGet, "http://example.com", new(bytes.Buffer))
+	if _, err := tr.RoundTrip(req); err != nil {
+		t.Fatalf("error calling RoundTrip: %v", err)
+	}
+
+	// The request's context is propagated to KMS.
+	e.signs.Store(0)
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, err := tr.RoundTrip(req.WithContext(ctx)); err == nil {
+		t.Fatal("expected error signing with cancelled context")
+	}
+	if got := e.signs.Load(); got != 0 {
+		t.Errorf("Sign calls = %d with cancelled context, want 0", got)
+	}
+}
+
+type roundTripFunc func(*http.Request) (*http.Response, error)
+
+func (f roundTripFunc) RoundTrip(req *http.Request) (*http.Response, error) {
+	return f(req)
+}
@@ -0,0 +1,6 @@
+// Package pkcs11signer provides a crypto.Signer backed by an RSA private key
+// held in a PKCS#11 token, such as an HSM, for use with
+// ghinstallation.NewAppsTransportFromSigner.
+//
+// This package requires cgo, and is empty when built without it.
+package pkcs11signer
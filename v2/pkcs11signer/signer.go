@@ -0,0 +1,273 @@
+//go:build cgo
+
+package pkcs11signer
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/rsa"
+	"errors"
+	"fmt"
+	"io"
+	"math/big"
+	"sync"
+
+	"github.com/miekg/pkcs11"
+)
+
+// defaultMaxSessions is the number of sessions opened when Config.MaxSessions
+// is not set.
+const defaultMaxSessions = 4
+
+// sha256DigestInfo is the DER encoded DigestInfo prefix for SHA-256, which
+// must precede the digest when signing with CKM_RSA_PKCS.
+var sha256DigestInfo = []byte{0x30, 0x31, 0x30, 0x0d, 0x06, 0x09, 0x60, 0x86, 0x48, 0x01, 0x65, 0x03, 0x04, 0x02, 0x01, 0x05, 0x00, 0x04, 0x20}
+
+// Config describes how to locate the GitHub App's private key in a PKCS#11 token.
+type Config struct {
+	Module      string // Module is the path to the PKCS#11 module, such as /usr/lib/softhsm/libsofthsm2.so
+	TokenLabel  string // TokenLabel selects the slot whose token has this label
+	PIN         string // PIN is the user PIN for the token
+	KeyLabel    string // KeyLabel selects the private key by CKA_LABEL, optional if KeyID is set
+	KeyID       []byte // KeyID selects the private key by CKA_ID, optional if KeyLabel is set
+	MaxSessions int    // MaxSessions bounds the number of concurrent sessions, defaults to 4
+}
+
+// Signer is a crypto.Signer which signs using a private key in a PKCS#11 token.
+//
+// Sessions are pooled, so Sign is safe to be used concurrently, such as from
+// concurrent AppsTransport.RoundTrip calls.
+type Signer struct {
+	ctx  *pkcs11.Ctx
+	slot uint
+	key  pkcs11.ObjectHandle // key is the private key, valid in all of ctx's sessions
+	pub  *rsa.PublicKey
+
+	login pkcs11.SessionHandle      // login is kept open to keep the token logged in, and is not used to sign
+	sem   chan struct{}             // sem bounds the number of open signing sessions
+	idle  chan pkcs11.SessionHandle // idle contains open signing sessions not in use
+
+	closeOnce sync.Once
+}
+
+var _ crypto.Signer = &Signer{}
+
+// New loads the PKCS#11 module, logs in to the token and locates the RSA
+// private key described by cfg. The returned Signer should be closed when
+// no longer required.
+func New(cfg Config) (*Signer, error) {
+	if cfg.KeyLabel == "" && len(cfg.KeyID) == 0 {
+		return nil, errors.New("pkcs11signer: one of KeyLabel or KeyID is required")
+	}
+	if cfg.MaxSessions <= 0 {
+		cfg.MaxSessions = defaultMaxSessions
+	}
+
+	ctx := pkcs11.New(cfg.Module)
+	if ctx == nil {
+		return nil, fmt.Errorf("pkcs11signer: could not load module %q", cfg.Module)
+	}
+	if err := ctx.Initialize(); err != nil {
+		ctx.Destroy()
+		return nil, fmt.Errorf("pkcs11signer: could not initialize module: %s", err)
+	}
+
+	s := &Signer{
+		ctx:  ctx,
+		sem:  make(chan struct{}, cfg.MaxSessions),
+		idle: make(chan pkcs11.SessionHandle, cfg.MaxSessions),
+	}
+	if err := s.init(cfg); err != nil {
+		s.Close()
+		return nil, err
+	}
+	return s, nil
+}
+
+// init locates the slot, logs in and finds the private key.
+func (s *Signer) init(cfg Config) error {
+	slot, err := findSlot(s.ctx, cfg.TokenLabel)
+	if err != nil {
+		return err
+	}
+	s.slot = slot
+
+	sh, err := s.ctx.OpenSession(slot, pkcs11.CKF_SERIAL_SESSION)
+	if err != nil {
+		return fmt.Errorf("pkcs11signer: could not open session: %s", err)
+	}
+	// Login state is shared by all sessions to the token, so logging in
+	// once is sufficient for sessions opened later. The token is logged out
+	// when its last session is closed, so this session is kept open until
+	// Close, allowing signing sessions to be discarded after errors.
+	if err := s.ctx.Login(sh, pkcs11.CKU_USER, cfg.PIN); err != nil && !errors.Is(err, pkcs11.Error(pkcs11.CKR_USER_ALREADY_LOGGED_IN)) {
+		s.ctx.CloseSession(sh)
+		return fmt.Errorf("pkcs11signer: could not login: %s", err)
+	}
+	s.login = sh
+
+	key, err := findKey(s.ctx, sh, cfg.KeyLabel, cfg.KeyID)
+	if err != nil {
+		return err
+	}
+	s.key = key
+
+	attrs, err := s.ctx.GetAttributeValue(sh, key, []*pkcs11.Attribute{
+		pkcs11.NewAttribute(pkcs11.CKA_MODULUS, nil),
+		pkcs11.NewAttribute(pkcs11.CKA_PUBLIC_EXPONENT, nil),
+	})
+	if err != nil {
+		return fmt.Errorf("pkcs11signer: could not read public key: %s", err)
+	}
+	s.pub = &rsa.PublicKey{
+		N: new(big.Int).SetBytes(attrs[0].Value),
+		E: int(new(big.Int).SetBytes(attrs[1].Value).Int64()),
+	}
+	return nil
+}
+
+// findSlot returns the first slot with a token, or the slot whose token has
+// the label tokenLabel if not empty.
+func findSlot(ctx *pkcs11.Ctx, tokenLabel string) (uint, error) {
+	slots, err := ctx.GetSlotList(true)
+	if err != nil {
+		return 0, fmt.Errorf("pkcs11signer: could not list slots: %s", err)
+	}
+	for _, slot := range slots {
+		if tokenLabel == "" {
+			return slot, nil
+		}
+		info, err := ctx.GetTokenInfo(slot)
+		if err != nil {
+			return 0, fmt.Errorf("pkcs11signer: could not get token info for slot %d: %s", slot, err)
+		}
+		if info.Label == tokenLabel {
+			return slot, nil
+		}
+	}
+	return 0, fmt.Errorf("pkcs11signer: no token found with label %q", tokenLabel)
+}
+
+// findKey returns the single RSA private key matching label and id.
+func findKey(ctx *pkcs11.Ctx, sh pkcs11.SessionHandle, label string, id []byte) (pkcs11.ObjectHandle, error) {
+	template := []*pkcs11.Attribute{
+		pkcs11.NewAttribute(pkcs11.CKA_CLASS, pkcs11.CKO_PRIVATE_KEY),
+		pkcs11.NewAttribute(pkcs11.CKA_KEY_TYPE, pkcs11.CKK_RSA),
+	}
+	if label != "" {
+		template = append(template, pkcs11.NewAttribute(pkcs11.CKA_LABEL, label))
+	}
+	if len(id) > 0 {
+		template = append(template, pkcs11.NewAttribute(pkcs11.CKA_ID, id))
+	}
+
+	if err := ctx.FindObjectsInit(sh, template); err != nil {
+		return 0, fmt.Errorf("pkcs11signer: could not find private key: %s", err)
+	}
+	objs, _, err := ctx.FindObjects(sh, 2)
+	if ferr := ctx.FindObjectsFinal(sh); err == nil {
+		err = ferr
+	}
+	if err != nil {
+		return 0, fmt.Errorf("pkcs11signer: could not find private key: %s", err)
+	}
+	switch len(objs) {
+	case 0:
+		return 0, fmt.Errorf("pkcs11signer: no RSA private key found with label %q and id %x", label, id)
+	case 1:
+		return objs[0], nil
+	default:
+		return 0, fmt.Errorf("pkcs11signer: multiple RSA private keys found with label %q and id %x", label, id)
+	}
+}
+
+// Public implements crypto.Signer.
+func (s *Signer) Public() crypto.PublicKey {
+	return s.pub
+}
+
+// Sign implements crypto.Signer. Only PKCS #1 v1.5 signatures of SHA-256
+// digests are supported, as required for RS256 JWTs.
+func (s *Signer) Sign(_ io.Reader, digest []byte, opts crypto.SignerOpts) ([]byte, error) {
+	if opts.HashFunc() != crypto.SHA256 {
+		return nil, fmt.Errorf("pkcs11signer: unsupported hash function %v", opts.HashFunc())
+	}
+	if _, ok := opts.(*rsa.PSSOptions); ok {
+		return nil, errors.New("pkcs11signer: RSA-PSS signatures are not supported")
+	}
+	if len(digest) != crypto.SHA256.Size() {
+		return nil, fmt.Errorf("pkcs11signer: digest length %d, want %d", len(digest), crypto.SHA256.Size())
+	}
+
+	sh, err := s.getSession()
+	if err != nil {
+		return nil, err
+	}
+
+	sig, err := s.sign(sh, digest)
+	if err != nil {
+		// The session may be in an unknown state, so discard it.
+		s.ctx.CloseSession(sh)
+		<-s.sem
+		return nil, err
+	}
+	s.putSession(sh)
+	return sig, nil
+}
+
+func (s *Signer) sign(sh pkcs11.SessionHandle, digest []byte) ([]byte, error) {
+	mech := []*pkcs11.Mechanism{pkcs11.NewMechanism(pkcs11.CKM_RSA_PKCS, nil)}
+	if err := s.ctx.SignInit(sh, mech, s.key); err != nil {
+		return nil, fmt.Errorf("pkcs11signer: could not initialize signing: %s", err)
+	}
+	sig, err := s.ctx.Sign(sh, bytes.Join([][]byte{sha256DigestInfo, digest}, nil))
+	if err != nil {
+		return nil, fmt.Errorf("pkcs11signer: could not sign: %s", err)
+	}
+	return sig, nil
+}
+
+// getSession returns an idle session, or opens a new session if fewer than
+// MaxSessions are open, otherwise it blocks until a session is returned.
+func (s *Signer) getSession() (pkcs11.SessionHandle, error) {
+	select {
+	case sh := <-s.idle:
+		return sh, nil
+	case s.sem <- struct{}{}:
+	}
+	// A session may have been returned while acquiring sem.
+	select {
+	case sh := <-s.idle:
+		<-s.sem
+		return sh, nil
+	default:
+	}
+	sh, err := s.ctx.OpenSession(s.slot, pkcs11.CKF_SERIAL_SESSION)
+	if err != nil {
+		<-s.sem
+		return 0, fmt.Errorf("pkcs11signer: could not open session: %s", err)
+	}
+	return sh, nil
+}
+
+// putSession returns sh to the pool of idle sessions.
+func (s *Signer) putSession(sh pkcs11.SessionHandle) {
+	s.idle <- sh
+}
+
+// Close closes all sessions and unloads the PKCS#11 module. Close must not
+// be called while Sign is in use.
+func (s *Signer) Close() error {
+	s.closeOnce.Do(func() {
+		for len(s.idle) > 0 {
+			s.ctx.CloseSession(<-s.idle)
+		}
+		// Zero is CK_INVALID_HANDLE, if init failed before logging in.
+		if s.login != 0 {
+			s.ctx.CloseSession(s.login)
+		}
+		s.ctx.Finalize()
+		s.ctx.Destroy()
+	})
+	return nil
+}
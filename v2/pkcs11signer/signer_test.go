@@ -0,0 +1,194 @@
+//go:build cgo
+
+package pkcs11signer
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/miekg/pkcs11"
+	"github.com/pagerguild/ghinstallation/v2"
+)
+
+const (
+	tokenLabel = "ghinstallation"
+	pin        = "1234"
+	keyLabel   = "github-app"
+)
+
+// softHSM returns the path to the SoftHSM module, skipping the test if it is
+// not configured. The token is expected to be initialised with:
+//
+//	softhsm2-util --init-token --free --label ghinstallation --pin 1234 --so-pin 5678
+func softHSM(t *testing.T) string {
+	module := os.Getenv("SOFTHSM2_MODULE")
+	if module == "" {
+		t.Skip("SOFTHSM2_MODULE not set, skipping PKCS#11 tests")
+	}
+	return module
+}
+
+// generateKey creates an RSA key pair in the token, returning its CKA_ID.
+func generateKey(t *testing.T, module string) []byte {
+	ctx := pkcs11.New(module)
+	if ctx == nil {
+		t.Fatalf("could not load module %q", module)
+	}
+	if err := ctx.Initialize(); err != nil {
+		t.Fatal(err)
+	}
+	defer ctx.Destroy()
+	defer ctx.Finalize()
+
+	slot, err := findSlot(ctx, tokenLabel)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sh, err := ctx.OpenSession(slot, pkcs11.CKF_SERIAL_SESSION|pkcs11.CKF_RW_SESSION)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ctx.CloseSession(sh)
+	if err := ctx.Login(sh, pkcs11.CKU_USER, pin); err != nil {
+		t.Fatal(err)
+	}
+
+	// Keys persist in the token, so use a unique ID for each run.
+	id := make([]byte, 16)
+	if _, err := rand.Read(id); err != nil {
+		t.Fatal(err)
+	}
+	_, _, err = ctx.GenerateKeyPair(sh,
+		[]*pkcs11.Mechanism{pkcs11.NewMechanism(pkcs11.CKM_RSA_PKCS_KEY_PAIR_GEN, nil)},
+		[]*pkcs11.Attribute{
+			pkcs11.NewAttribute(pkcs11.CKA_TOKEN, false),
+			pkcs11.NewAttribute(pkcs11.CKA_VERIFY, true),
+			pkcs11.NewAttribute(pkcs11.CKA_MODULUS_BITS, 2048),
+			pkcs11.NewAttribute(pkcs11.CKA_PUBLIC_EXPONENT, []byte{1, 0, 1}),
+			pkcs11.NewAttribute(pkcs11.CKA_LABEL, keyLabel),
+			pkcs11.NewAttribute(pkcs11.CKA_ID, id),
+		},
+		[]*pkcs11.Attribute{
+			pkcs11.NewAttribute(pkcs11.CKA_TOKEN, true),
+			pkcs11.NewAttribute(pkcs11.CKA_SIGN, true),
+			pkcs11.NewAttribute(pkcs11.CKA_SENSITIVE, true),
+			pkcs11.NewAttribute(pkcs11.CKA_EXTRACTABLE, false),
+			pkcs11.NewAttribute(pkcs11.CKA_LABEL, keyLabel),
+			pkcs11.NewAttribute(pkcs11.CKA_ID, id),
+		},
+	)
+	if err != nil {
+		t.Fatalf("could not generate key pair: %v", err)
+	}
+	return id
+}
+
+func TestNew_config(t *testing.T) {
+	if _, err := New(Config{Module: "/nonexistent.so"}); err == nil {
+		t.Error("expected error without KeyLabel or KeyID")
+	}
+	if _, err := New(Config{Module: "/nonexistent.so", KeyLabel: keyLabel}); err == nil {
+		t.Error("expected error loading nonexistent module")
+	}
+}
+
+func TestSigner(t *testing.T) {
+	module := softHSM(t)
+	id := generateKey(t, module)
+
+	s, err := New(Config{Module: module, TokenLabel: tokenLabel, PIN: pin, KeyID: id, MaxSessions: 2})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+
+	// Sign concurrently with more callers than sessions.
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			digest := sha256.Sum256([]byte("message"))
+			sig, err := s.Sign(nil, digest[:], crypto.SHA256)
+			if err != nil {
+				t.Errorf("Sign: %v", err)
+				return
+			}
+			if err := rsa.VerifyPKCS1v15(s.Public().(*rsa.PublicKey), crypto.SHA256, digest[:], sig); err != nil {
+				t.Errorf("VerifyPKCS1v15: %v", err)
+			}
+		}()
+	}
+	wg.Wait()
+}
+
+func TestSigner_discardedSessions(t *testing.T) {
+	module := softHSM(t)
+	id := generateKey(t, module)
+
+	s, err := New(Config{Module: module, TokenLabel: tokenLabel, PIN: pin, KeyID: id, MaxSessions: 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+
+	digest := sha256.Sum256([]byte("message"))
+	if _, err := s.Sign(nil, digest[:], crypto.SHA256); err != nil {
+		t.Fatal(err)
+	}
+	// Discard every signing session, as Sign does after an error. The token
+	// must stay logged in for the next session.
+	sh := <-s.idle
+	s.ctx.CloseSession(sh)
+	<-s.sem
+	if _, err := s.Sign(nil, digest[:], crypto.SHA256); err != nil {
+		t.Fatalf("Sign after discarding sessions: %v", err)
+	}
+}
+
+func TestSigner_appsTransport(t *testing.T) {
+	module := softHSM(t)
+	id := generateKey(t, module)
+
+	s, err := New(Config{Module: module, TokenLabel: tokenLabel, PIN: pin, KeyID: id})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+
+	check := roundTripFunc(func(req *http.Request) (*http.Response, error) {
+		token := strings.Fields(req.Header.Get("Authorization"))[1]
+		_, err := jwt.NewParser(jwt.WithValidMethods([]string{"RS256"})).Parse(token, func(*jwt.Token) (interface{}, error) {
+			return s.Public(), nil
+		})
+		if err != nil {
+			t.Errorf("jwt parse: %v", err)
+		}
+		return nil, nil
+	})
+
+	tr, err := ghinstallation.NewAppsTransportFromSigner(check, "Iv1.0123456789abcdef", s)
+	if err != nil {
+		t.Fatal(err)
+	}
+	req := httptest.NewRequest(http.MethodGet, "http://example.com", new(bytes.Buffer))
+	if _, err := tr.RoundTrip(req); err != nil {
+		t.Fatalf("error calling RoundTrip: %v", err)
+	}
+}
+
+type roundTripFunc func(*http.Request) (*http.Response, error)
+
+func (f roundTripFunc) RoundTrip(req *http.Request) (*http.Response, error) {
+	return f(req)
+}
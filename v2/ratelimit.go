@@ -0,0 +1,179 @@
+package ghinstallation
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// RateLimit is an installation's rate limit budget for a resource, as last
+// reported by GitHub's X-RateLimit-* response headers.
+type RateLimit struct {
+	Limit     int       // Limit is the number of requests allowed per window
+	Remaining int       // Remaining is the number of requests left in the window
+	Reset     time.Time // Reset is when the window resets
+	Resource  string    // Resource is the rate limit resource, such as core, search or graphql
+}
+
+// RateLimitPolicy configures how Transport protects an installation's rate
+// limit budget. The zero value tracks the budget but never delays or rejects
+// requests.
+type RateLimitPolicy struct {
+	// Floor is the number of requests to keep in reserve. Requests which
+	// would take the remaining budget under Floor are delayed until the
+	// window resets if Wait is set, or fail with a *RateLimitError. Zero
+	// disables the check, so requests are sent and GitHub's own rate limit
+	// responses are returned.
+	Floor int
+	// Wait delays requests under Floor until the window resets, bounded by
+	// the request's context and MaxWait.
+	Wait bool
+	// MaxWait is the longest a request is delayed, requests which would
+	// wait longer fail with a *RateLimitError. Zero means no limit.
+	MaxWait time.Duration
+}
+
+// RateLimitError is returned when a request would take an installation's rate
+// limit budget under RateLimitPolicy.Floor.
+type RateLimitError struct {
+	InstallationID int64
+	RateLimit      RateLimit
+	Floor          int
+}
+
+func (e *RateLimitError) Error() string {
+	return fmt.Sprintf("installation ID %v has %d of %d %s requests remaining, under the floor of %d until %v",
+		e.InstallationID, e.RateLimit.Remaining, e.RateLimit.Limit, e.RateLimit.Resource, e.Floor, e.RateLimit.Reset)
+}
+
+// RateLimit returns the installation's last known core rate limit budget, and
+// false if no response reporting it has been received or its window has reset.
+func (t *Transport) RateLimit() (RateLimit, bool) {
+	return t.RateLimitFor("core")
+}
+
+// RateLimitFor returns the installation's last known rate limit budget for
+// resource, see RateLimit.
+func (t *Transport) RateLimitFor(resource string) (RateLimit, bool) {
+	t.rateMu.Lock()
+	defer t.rateMu.Unlock()
+	rl, ok := t.rateLimits[resource]
+	if !ok || !rl.Reset.After(time.Now()) {
+		return RateLimit{}, false
+	}
+	return rl, true
+}
+
+// reserveRateLimit checks the budget of the resource req would use against
+// the RateLimitPolicy, waiting or returning a *RateLimitError if it is under
+// the floor, and otherwise counts req as in flight until the returned release
+// func is called with its response. Without a floor, req is only counted.
+func (t *Transport) reserveRateLimit(req *http.Request) (release func(*http.Response), err error) {
+	resource := rateLimitResource(req)
+	for {
+		t.rateMu.Lock()
+		rl, ok := t.rateLimits[resource]
+		if ok && rl.Reset.After(time.Now()) {
+			// Requests in flight are not yet reflected in the budget GitHub
+			// reported, so count them against it.
+			rl.Remaining = max(rl.Remaining-t.inFlight[resource], 0)
+		} else {
+			ok = false
+		}
+		if !ok || t.RateLimitPolicy.Floor <= 0 || rl.Remaining-1 >= t.RateLimitPolicy.Floor {
+			if t.inFlight == nil {
+				t.inFlight = make(map[string]int)
+			}
+			t.inFlight[resource]++
+			t.rateMu.Unlock()
+			return func(resp *http.Response) {
+				if resp != nil {
+					t.updateRateLimit(resp)
+				}
+				t.rateMu.Lock()
+				t.inFlight[resource]--
+				t.rateMu.Unlock()
+			}, nil
+		}
+		t.rateMu.Unlock()
+
+		e := &RateLimitError{InstallationID: t.installationID, RateLimit: rl, Floor: t.RateLimitPolicy.Floor}
+		wait := time.Until(rl.Reset)
+		if !t.RateLimitPolicy.Wait || (t.RateLimitPolicy.MaxWait > 0 && wait > t.RateLimitPolicy.MaxWait) {
+			return nil, e
+		}
+		if deadline, ok := req.Context().Deadline(); ok && time.Until(deadline) < wait {
+			return nil, e
+		}
+		if !sleep(req.Context(), wait) {
+			return nil, req.Context().Err()
+		}
+	}
+}
+
+// updateRateLimit records the budget reported by resp's headers, which is
+// the source of truth for the budget: requests GitHub does not count, such as
+// 304 Not Modified responses, leave it unchanged.
+func (t *Transport) updateRateLimit(resp *http.Response) {
+	rl, ok := parseRateLimit(resp.Header)
+	if !ok {
+		return
+	}
+	t.rateMu.Lock()
+	defer t.rateMu.Unlock()
+	if t.rateLimits == nil {
+		t.rateLimits = make(map[string]RateLimit)
+	}
+	// Responses may arrive out of order, so only a newer window or a lower
+	// remaining count in the same window replaces the known budget.
+	if prev, ok := t.rateLimits[rl.Resource]; ok && prev.Reset.Equal(rl.Reset) && prev.Remaining < rl.Remaining {
+		return
+	}
+	if prev, ok := t.rateLimits[rl.Resource]; ok && prev.Reset.After(rl.Reset) {
+		return
+	}
+	t.rateLimits[rl.Resource] = rl
+}
+
+// parseRateLimit parses GitHub's X-RateLimit-* headers.
+func parseRateLimit(h http.Header) (RateLimit, bool) {
+	limit, err := strconv.Atoi(h.Get("X-RateLimit-Limit"))
+	if err != nil {
+		return RateLimit{}, false
+	}
+	remaining, err := strconv.Atoi(h.Get("X-RateLimit-Remaining"))
+	if err != nil {
+		return RateLimit{}, false
+	}
+	reset, err := strconv.ParseInt(h.Get("X-RateLimit-Reset"), 10, 64)
+	if err != nil {
+		return RateLimit{}, false
+	}
+	resource := h.Get("X-RateLimit-Resource")
+	if resource == "" {
+		resource = "core"
+	}
+	return RateLimit{
+		Limit:     limit,
+		Remaining: remaining,
+		Reset:     time.Unix(reset, 0),
+		Resource:  resource,
+	}, true
+}
+
+// rateLimitResource returns the rate limit resource req is expected to count
+// against, as GitHub only reports it in the response.
+func rateLimitResource(req *http.Request) string {
+	path := strings.TrimPrefix(req.URL.Path, "/api/v3")
+	switch {
+	case path == "/graphql" || path == "/api/graphql":
+		return "graphql"
+	case strings.HasPrefix(path, "/search/code"):
+		return "code_search"
+	case strings.HasPrefix(path, "/search/"):
+		return "search"
+	}
+	return "core"
+}
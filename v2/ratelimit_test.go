@@ -0,0 +1,201 @@
+package ghinstallation
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// newRateLimitServer returns a server serving installation tokens and
+// reporting a core budget of remaining requests, decremented per request.
+// Requests once the budget is exhausted fail with 403, as on GitHub.
+func newRateLimitServer(t *testing.T, remaining int, reset time.Time) (*httptest.Server, *atomic.Int32) {
+	var calls atomic.Int32
+	ts := newTokenServer(t, func(w http.ResponseWriter, r *http.Request) {
+		n := int(calls.Add(1))
+		w.Header().Set("X-RateLimit-Limit", "5000")
+		w.Header().Set("X-RateLimit-Remaining", strconv.Itoa(max(remaining-n, 0)))
+		w.Header().Set("X-RateLimit-Reset", strconv.FormatInt(reset.Unix(), 10))
+		w.Header().Set("X-RateLimit-Resource", "core")
+		if remaining-n < 0 {
+			w.WriteHeader(http.StatusForbidden)
+		}
+	})
+	return ts, &calls
+}
+
+func TestTransport_RateLimit(t *testing.T) {
+	reset := time.Now().Add(time.Hour).Truncate(time.Second)
+	ts, _ := newRateLimitServer(t, 100, reset)
+	tr := newTestTransport(t, ts, installationID)
+
+	if _, ok := tr.RateLimit(); ok {
+		t.Error("RateLimit reported before any response")
+	}
+	client := http.Client{Transport: tr}
+	for i := 0; i < 2; i++ {
+		resp, err := client.Get(ts.URL + "/repos/o/r")
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+	}
+
+	got, ok := tr.RateLimit()
+	want := RateLimit{Limit: 5000, Remaining: 98, Reset: reset, Resource: "core"}
+	if !ok || got != want {
+		t.Errorf("RateLimit() = %+v, %v, want %+v, true", got, ok, want)
+	}
+	if _, ok := tr.RateLimitFor("search"); ok {
+		t.Error("RateLimitFor(search) reported without a search response")
+	}
+}
+
+func TestTransport_RateLimitFloor(t *testing.T) {
+	ts, calls := newRateLimitServer(t, 12, time.Now().Add(time.Hour))
+	tr := newTestTransport(t, ts, installationID)
+	tr.RateLimitPolicy = RateLimitPolicy{Floor: 10}
+
+	client := http.Client{Transport: tr}
+	resp, err := client.Get(ts.URL + "/repos/o/r")
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+
+	// 11 requests remain, so one more request is allowed before the floor.
+	resp, err = client.Get(ts.URL + "/repos/o/r")
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+
+	_, err = client.Get(ts.URL + "/repos/o/r")
+	var rlErr *RateLimitError
+	if !errors.As(err, &rlErr) {
+		t.Fatalf("error = %v, want *RateLimitError", err)
+	}
+	if rlErr.RateLimit.Remaining != 10 || rlErr.Floor != 10 {
+		t.Errorf("RateLimitError = %+v, want 10 remaining under floor 10", rlErr)
+	}
+	if n := calls.Load(); n != 2 {
+		t.Errorf("requests = %d, want 2", n)
+	}
+
+	// Search requests have a separate budget.
+	resp, err = client.Get(ts.URL + "/search/issues?q=x")
+	if err != nil {
+		t.Fatalf("search request: %v", err)
+	}
+	resp.Body.Close()
+}
+
+func TestTransport_RateLimitNoFloor(t *testing.T) {
+	ts, calls := newRateLimitServer(t, 1, time.Now().Add(time.Hour))
+	tr := newTestTransport(t, ts, installationID)
+
+	// The zero policy sends requests with no budget left, so GitHub's own
+	// response is returned.
+	client := http.Client{Transport: tr}
+	for i, want := range []int{http.StatusOK, http.StatusForbidden, http.StatusForbidden} {
+		resp, err := client.Get(ts.URL + "/repos/o/r")
+		if err != nil {
+			t.Fatalf("request %d: %v", i+1, err)
+		}
+		resp.Body.Close()
+		if resp.StatusCode != want {
+			t.Errorf("request %d: status = %d, want %d", i+1, resp.StatusCode, want)
+		}
+	}
+	if n := calls.Load(); n != 3 {
+		t.Errorf("requests = %d, want 3", n)
+	}
+	if rl, ok := tr.RateLimit(); !ok || rl.Remaining != 0 {
+		t.Errorf("RateLimit() = %+v, %v, want 0 remaining", rl, ok)
+	}
+}
+
+func TestTransport_RateLimitCache(t *testing.T) {
+	reset := strconv.FormatInt(time.Now().Add(time.Hour).Unix(), 10)
+	ts := newTokenServer(t, func(w http.ResponseWriter, r *http.Request) {
+		// Conditional requests answered with 304 are not counted by GitHub.
+		w.Header().Set("ETag", `"v1"`)
+		w.Header().Set("X-RateLimit-Limit", "5000")
+		w.Header().Set("X-RateLimit-Remaining", "20")
+		w.Header().Set("X-RateLimit-Reset", reset)
+		if r.Header.Get("If-None-Match") == `"v1"` {
+			w.WriteHeader(http.StatusNotModified)
+		}
+	})
+	tr := newTestTransport(t, ts, installationID)
+	tr.RateLimitPolicy = RateLimitPolicy{Floor: 10}
+	tr.Cache = NewCache(10)
+
+	client := http.Client{Transport: tr}
+	for i := 0; i < 30; i++ {
+		resp, err := client.Get(ts.URL + "/repos/o/r/pulls")
+		if err != nil {
+			t.Fatalf("poll %d: %v", i+1, err)
+		}
+		resp.Body.Close()
+	}
+	if rl, ok := tr.RateLimit(); !ok || rl.Remaining != 20 {
+		t.Errorf("RateLimit() = %+v, %v, want 20 remaining", rl, ok)
+	}
+}
+
+func TestTransport_RateLimitWait(t *testing.T) {
+	// The reset is sent in whole seconds, so allow for truncation.
+	ts, calls := newRateLimitServer(t, 2, time.Now().Add(1500*time.Millisecond))
+	tr := newTestTransport(t, ts, installationID)
+	tr.RateLimitPolicy = RateLimitPolicy{Floor: 1, Wait: true}
+
+	client := http.Client{Transport: tr}
+	resp, err := client.Get(ts.URL + "/repos/o/r")
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+
+	// A context ending before the reset fails fast.
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	req, _ := http.NewRequestWithContext(ctx, http.MethodGet, ts.URL+"/repos/o/r", nil)
+	var rlErr *RateLimitError
+	if _, err := client.Do(req); !errors.As(err, &rlErr) {
+		t.Fatalf("error = %v, want *RateLimitError", err)
+	}
+
+	// Otherwise the request waits for the window to reset.
+	resp, err = client.Get(ts.URL + "/repos/o/r")
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if n := calls.Load(); n != 2 {
+		t.Errorf("requests = %d, want 2", n)
+	}
+}
+
+func TestRateLimitResource(t *testing.T) {
+	tests := map[string]string{
+		"https://api.github.com/repos/o/r":                  "core",
+		"https://api.github.com/search/issues":              "search",
+		"https://api.github.com/search/code":                "code_search",
+		"https://api.github.com/graphql":                    "graphql",
+		"https://github.example.com/api/v3/search/issues":   "search",
+		"https://github.example.com/api/graphql":            "graphql",
+		"https://github.example.com/api/v3/repos/o/r/pulls": "core",
+	}
+	for url, want := range tests {
+		req := httptest.NewRequest(http.MethodGet, url, nil)
+		if got := rateLimitResource(req); got != want {
+			t.Errorf("rateLimitResource(%q) = %q, want %q", url, got, want)
+		}
+	}
+}
@@ -0,0 +1,69 @@
+package ghinstallation
+
+import (
+	"errors"
+	"net/http"
+	"strings"
+)
+
+// maxRedirects matches the limit of http.Client's default redirect policy.
+const maxRedirects = 10
+
+// CheckRedirect is a redirect policy for an http.Client using Transport,
+// which removes the Authorization header from a redirected request once the
+// redirect chain has left the original request's host. It is stricter than
+// http.Client's default policy, which keeps the header for subdomains and
+// other ports of the original host.
+//
+//	client := &http.Client{Transport: itr, CheckRedirect: ghinstallation.CheckRedirect}
+func CheckRedirect(req *http.Request, via []*http.Request) error {
+	if len(via) >= maxRedirects {
+		return errors.New("stopped after 10 redirects")
+	}
+	if len(via) == 0 {
+		return nil
+	}
+	origin := strings.ToLower(via[0].URL.Host)
+	left := strings.ToLower(req.URL.Host) != origin
+	for _, r := range via[1:] {
+		if strings.ToLower(r.URL.Host) != origin {
+			left = true
+			break
+		}
+	}
+	if left {
+		req.Header.Del("Authorization")
+	}
+	return nil
+}
+
+// leftAllowedHosts reports whether req was redirected from a host the
+// installation token may not be sent to, in which case the token is not
+// applied again even if the redirect chain returns to an allowed host.
+func (t *Transport) leftAllowedHosts(req *http.Request) bool {
+	for resp := req.Response; resp != nil && resp.Request != nil; resp = resp.Request.Response {
+		if !t.tokenAllowed(resp.Request.URL) {
+			return true
+		}
+	}
+	return false
+}
+
+// stripToken removes the installation token from req's headers, where it
+// may have been copied by http.Client when following a redirect, returning
+// a copy of req if the token was removed.
+func (t *Transport) stripToken(req *http.Request) *http.Request {
+	auth := req.Header.Get("Authorization")
+	if auth == "" {
+		return req
+	}
+	t.mu.Lock()
+	own := t.token != nil && auth == "token "+t.token.Token
+	t.mu.Unlock()
+	if !own {
+		return req
+	}
+	req = req.Clone(req.Context())
+	req.Header.Del("Authorization")
+	return req
+}
@@ -0,0 +1,187 @@
+package ghinstallation
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// authLog records the Authorization header received for each path.
+type authLog struct {
+	mu   sync.Mutex
+	auth map[string]string
+}
+
+func (l *authLog) record(r *http.Request) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.auth == nil {
+		l.auth = make(map[string]string)
+	}
+	l.auth[r.URL.Path] = r.Header.Get("Authorization")
+}
+
+func (l *authLog) get(path string) (string, bool) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	auth, ok := l.auth[path]
+	return auth, ok
+}
+
+// newArtifactServers returns an API server redirecting artifact downloads to
+// a storage server, which redirects within itself and back to the API.
+func newArtifactServers(t *testing.T) (api, storage *httptest.Server, log *authLog) {
+	log = &authLog{}
+	api = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		log.record(r)
+		switch r.URL.Path {
+		case fmt.Sprintf("/app/installations/%v/access_tokens", installationID):
+			fmt.Fprintf(w, `{"token":%q,"expires_at":%q}`, token, time.Now().Add(time.Hour).Format(time.RFC3339))
+		case "/repos/o/r/actions/artifacts/1/zip":
+			http.Redirect(w, r, storage.URL+"/blob?sig=abc", http.StatusFound)
+		case "/repos/o/r/actions/artifacts/2/zip":
+			http.Redirect(w, r, storage.URL+"/bounce", http.StatusFound)
+		default:
+			io.WriteString(w, "api")
+		}
+	}))
+	t.Cleanup(api.Close)
+	storage = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		log.record(r)
+		switch r.URL.Path {
+		case "/blob":
+			http.Redirect(w, r, "/blob2", http.StatusFound)
+		case "/bounce":
+			http.Redirect(w, r, api.URL+"/final", http.StatusFound)
+		default:
+			io.WriteString(w, "artifact")
+		}
+	}))
+	t.Cleanup(storage.Close)
+	return api, storage, log
+}
+
+func TestTransport_redirect(t *testing.T) {
+	for name, checkRedirect := range map[string]func(*http.Request, []*http.Request) error{
+		"default":       nil,
+		"CheckRedirect": CheckRedirect,
+	} {
+		t.Run(name, func(t *testing.T) {
+			api, _, log := newArtifactServers(t)
+			tr, err := New(api.Client().Transport, appID, installationID, key)
+			if err != nil {
+				t.Fatal(err)
+			}
+			tr.BaseURL = api.URL
+			client := &http.Client{Transport: tr, CheckRedirect: checkRedirect}
+
+			for _, path := range []string{"/repos/o/r/actions/artifacts/1/zip", "/repos/o/r/actions/artifacts/2/zip"} {
+				resp, err := client.Get(api.URL + path)
+				if err != nil {
+					t.Fatal(err)
+				}
+				resp.Body.Close()
+				if auth, _ := log.get(path); auth != "token "+token {
+					t.Errorf("%s: Authorization = %q, want the installation token", path, auth)
+				}
+			}
+			for _, path := range []string{"/blob", "/blob2", "/bounce", "/final"} {
+				auth, ok := log.get(path)
+				if !ok {
+					t.Errorf("%s: not requested", path)
+				}
+				if auth != "" {
+					t.Errorf("%s: Authorization = %q, want none after leaving the API host", path, auth)
+				}
+			}
+		})
+	}
+}
+
+func TestTransport_stripToken(t *testing.T) {
+	var got *http.Request
+	rt := &RoundTrip{rt: func(req *http.Request) (*http.Response, error) {
+		got = req
+		return &http.Response{StatusCode: http.StatusOK, Body: http.NoBody}, nil
+	}}
+	tr, err := New(rt, appID, installationID, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tr.token = &accessToken{Token: token, ExpiresAt: time.Now().Add(time.Hour)}
+
+	// A client may copy the token from the original request to a redirect.
+	req := httptest.NewRequest(http.MethodGet, "https://objects.githubusercontent.com/asset", nil)
+	req.Header.Set("Authorization", "token "+token)
+	if _, err := tr.RoundTrip(req); err != nil {
+		t.Fatal(err)
+	}
+	if auth := got.Header.Get("Authorization"); auth != "" {
+		t.Errorf("Authorization = %q, want the installation token removed", auth)
+	}
+
+	// Other credentials for the host are left alone.
+	req.Header.Set("Authorization", "Bearer other")
+	if _, err := tr.RoundTrip(req); err != nil {
+		t.Fatal(err)
+	}
+	if auth := got.Header.Get("Authorization"); auth != "Bearer other" {
+		t.Errorf("Authorization = %q, want %q", auth, "Bearer other")
+	}
+}
+
+func TestCheckRedirect(t *testing.T) {
+	newRequest := func(url string) *http.Request {
+		req := httptest.NewRequest(http.MethodGet, url, nil)
+		req.Header.Set("Authorization", "token "+token)
+		return req
+	}
+	api := newRequest("https://api.github.com/repos/o/r/actions/artifacts/1/zip")
+
+	same := newRequest("https://api.github.com/repos/o/r/actions/artifacts/1/zip/")
+	if err := CheckRedirect(same, []*http.Request{api}); err != nil {
+		t.Fatal(err)
+	}
+	if same.Header.Get("Authorization") == "" {
+		t.Error("Authorization removed on same host redirect")
+	}
+
+	storage := newRequest("https://pipelines.actions.githubusercontent.com/blob")
+	if err := CheckRedirect(storage, []*http.Request{api}); err != nil {
+		t.Fatal(err)
+	}
+	if storage.Header.Get("Authorization") != "" {
+		t.Error("Authorization kept on cross host redirect")
+	}
+
+	back := newRequest("https://api.github.com/final")
+	if err := CheckRedirect(back, []*http.Request{api, storage}); err != nil {
+		t.Fatal(err)
+	}
+	if back.Header.Get("Authorization") != "" {
+		t.Error("Authorization kept after the redirect chain left the original host")
+	}
+
+	// via may have spare capacity owned by http.Client, which is not written.
+	via := make([]*http.Request, 2, 3)
+	via[0], via[1] = api, storage
+	if err := CheckRedirect(newRequest("https://api.github.com/final"), via); err != nil {
+		t.Fatal(err)
+	}
+	if spare := via[:3][2]; spare != nil {
+		t.Errorf("CheckRedirect wrote %v past the end of via", spare.URL)
+	}
+
+	via = make([]*http.Request, maxRedirects)
+	for i := range via {
+		via[i] = api
+	}
+	if err := CheckRedirect(same, via); err == nil || !strings.Contains(err.Error(), "redirects") {
+		t.Errorf("CheckRedirect after %d redirects = %v, want error", maxRedirects, err)
+	}
+}
@@ -0,0 +1,101 @@
+package ghinstallation
+
+import (
+	"context"
+	"math/rand"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+const (
+	defaultRetryMaxAttempts = 3
+	defaultRetryMinBackoff  = 500 * time.Millisecond
+	defaultRetryMaxBackoff  = 10 * time.Second
+)
+
+// RetryPolicy configures retries of installation token refreshes. Requests
+// are retried on network errors, 5xx responses and 429 responses, but not on
+// other responses such as 401, 403 or 404, or when the JWT cannot be signed.
+// The zero value uses the defaults.
+//
+// Retries use exponential backoff with jitter, or the delay requested by a
+// Retry-After header if longer, and are bounded by the request's context.
+// Requests are not retried if Retry-After asks for a longer delay than
+// MaxBackoff, since other requests wait for the token meanwhile.
+type RetryPolicy struct {
+	MaxAttempts int           // MaxAttempts is the maximum number of attempts including the first, defaults to 3, 1 disables retries
+	MinBackoff  time.Duration // MinBackoff is the delay before the first retry, defaults to 500ms
+	MaxBackoff  time.Duration // MaxBackoff is the maximum delay between retries, defaults to 10s
+}
+
+// backoff returns the delay before retrying after attempt failed with resp
+// and err, and false if the request should not be retried.
+func (p RetryPolicy) backoff(ctx context.Context, attempt int, resp *http.Response, err error) (time.Duration, bool) {
+	maxAttempts := p.MaxAttempts
+	if maxAttempts <= 0 {
+		maxAttempts = defaultRetryMaxAttempts
+	}
+	if attempt >= maxAttempts || ctx.Err() != nil {
+		return 0, false
+	}
+	if err == nil && resp.StatusCode/100 != 5 && resp.StatusCode != http.StatusTooManyRequests {
+		return 0, false
+	}
+
+	minBackoff, maxBackoff := p.MinBackoff, p.MaxBackoff
+	if minBackoff <= 0 {
+		minBackoff = defaultRetryMinBackoff
+	}
+	if maxBackoff <= 0 {
+		maxBackoff = defaultRetryMaxBackoff
+	}
+	wait := minBackoff << (attempt - 1)
+	if wait > maxBackoff || wait <= 0 {
+		wait = maxBackoff
+	}
+	// Jitter between half and the full delay avoids synchronized retries.
+	wait = wait/2 + time.Duration(rand.Int63n(int64(wait/2)+1))
+
+	if resp != nil {
+		if after, ok := retryAfter(resp); ok && after > wait {
+			if after > maxBackoff {
+				return 0, false
+			}
+			wait = after
+		}
+	}
+	// Give up now rather than waiting past the context's deadline.
+	if deadline, ok := ctx.Deadline(); ok && time.Until(deadline) < wait {
+		return 0, false
+	}
+	return wait, true
+}
+
+// retryAfter parses the response's Retry-After header, in either seconds or
+// HTTP date format.
+func retryAfter(resp *http.Response) (time.Duration, bool) {
+	v := resp.Header.Get("Retry-After")
+	if v == "" {
+		return 0, false
+	}
+	if secs, err := strconv.Atoi(v); err == nil && secs >= 0 {
+		return time.Duration(secs) * time.Second, true
+	}
+	if date, err := http.ParseTime(v); err == nil {
+		return time.Until(date), true
+	}
+	return 0, false
+}
+
+// sleep waits for d, returning false if ctx is done first.
+func sleep(ctx context.Context, d time.Duration) bool {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		return false
+	case <-timer.C:
+		return true
+	}
+}
@@ -0,0 +1,240 @@
+package ghinstallation
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// newFlakyServer returns a server failing token requests with the given
+// statuses before succeeding, and a count of the requests received.
+func newFlakyServer(t *testing.T, header http.Header, statuses ...int) (*httptest.Server, *atomic.Int32) {
+	var calls atomic.Int32
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		n := int(calls.Add(1))
+		if n <= len(statuses) {
+			for k, v := range header {
+				w.Header()[k] = v
+			}
+			w.WriteHeader(statuses[n-1])
+			return
+		}
+		writeToken(w)
+	}))
+	t.Cleanup(ts.Close)
+	return ts, &calls
+}
+
+func newRetryTransport(t *testing.T, ts *httptest.Server) *Transport {
+	tr := newTestTransport(t, ts, installationID)
+	tr.Retry = RetryPolicy{MinBackoff: time.Millisecond, MaxBackoff: 5 * time.Millisecond}
+	return tr
+}
+
+func TestRefreshToken_retry(t *testing.T) {
+	ts, calls := newFlakyServer(t, nil, http.StatusBadGateway, http.StatusServiceUnavailable)
+	tr := newRetryTransport(t, ts)
+
+	got, err := tr.Token(context.Background())
+	if err != nil {
+		t.Fatalf("Token: %v", err)
+	}
+	if got != token {
+		t.Errorf("Token = %q, want %q", got, token)
+	}
+	if n := calls.Load(); n != 3 {
+		t.Errorf("requests = %d, want 3", n)
+	}
+}
+
+func TestRefreshToken_retryExhausted(t *testing.T) {
+	ts, calls := newFlakyServer(t, nil, 500, 500, 500, 500)
+	tr := newRetryTransport(t, ts)
+
+	_, err := tr.Token(context.Background())
+	var httpErr *HTTPError
+	if !errors.As(err, &httpErr) {
+		t.Fatalf("Token error = %v, want *HTTPError", err)
+	}
+	if httpErr.Attempts != 3 {
+		t.Errorf("Attempts = %d, want 3", httpErr.Attempts)
+	}
+	if httpErr.Response.StatusCode != 500 {
+		t.Errorf("StatusCode = %d, want 500", httpErr.Response.StatusCode)
+	}
+	if n := calls.Load(); n != 3 {
+		t.Errorf("requests = %d, want 3", n)
+	}
+}
+
+func TestRefreshToken_noRetry(t *testing.T) {
+	for _, status := range []int{http.StatusUnauthorized, http.StatusForbidden, http.StatusNotFound} {
+		t.Run(http.StatusText(status), func(t *testing.T) {
+			ts, calls := newFlakyServer(t, nil, status)
+			tr := newRetryTransport(t, ts)
+
+			_, err := tr.Token(context.Background())
+			var httpErr *HTTPError
+			if !errors.As(err, &httpErr) {
+				t.Fatalf("Token error = %v, want *HTTPError", err)
+			}
+			if httpErr.Attempts != 1 {
+				t.Errorf("Attempts = %d, want 1", httpErr.Attempts)
+			}
+			if n := calls.Load(); n != 1 {
+				t.Errorf("requests = %d, want 1", n)
+			}
+		})
+	}
+}
+
+func TestRefreshToken_retryNetworkError(t *testing.T) {
+	var calls atomic.Int32
+	rt := &RoundTrip{rt: func(req *http.Request) (*http.Response, error) {
+		calls.Add(1)
+		return nil, errors.New("connection reset")
+	}}
+	tr, err := New(rt, appID, installationID, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tr.Retry = RetryPolicy{MaxAttempts: 2, MinBackoff: time.Millisecond}
+
+	_, err = tr.Token(context.Background())
+	var httpErr *HTTPError
+	if !errors.As(err, &httpErr) {
+		t.Fatalf("Token error = %v, want *HTTPError", err)
+	}
+	if httpErr.Attempts != 2 {
+		t.Errorf("Attempts = %d, want 2", httpErr.Attempts)
+	}
+	if n := calls.Load(); n != 2 {
+		t.Errorf("requests = %d, want 2", n)
+	}
+}
+
+func TestRefreshToken_retryAfterDeadline(t *testing.T) {
+	ts, calls := newFlakyServer(t, http.Header{"Retry-After": {"60"}}, http.StatusServiceUnavailable)
+	tr := newRetryTransport(t, ts)
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	start := time.Now()
+	_, err := tr.Token(ctx)
+	if err == nil {
+		t.Fatal("expected error when Retry-After exceeds the context deadline")
+	}
+	if elapsed := time.Since(start); elapsed > 500*time.Millisecond {
+		t.Errorf("Token took %v, want it to give up without waiting", elapsed)
+	}
+	if n := calls.Load(); n != 1 {
+		t.Errorf("requests = %d, want 1", n)
+	}
+}
+
+func TestRetryAfter(t *testing.T) {
+	tests := []struct {
+		value string
+		want  time.Duration
+		ok    bool
+	}{
+		{"", 0, false},
+		{"2", 2 * time.Second, true},
+		{"soon", 0, false},
+		{time.Now().Add(time.Minute).UTC().Format(http.TimeFormat), time.Minute, true},
+	}
+	for _, tt := range tests {
+		resp := &http.Response{Header: http.Header{"Retry-After": {tt.value}}}
+		got, ok := retryAfter(resp)
+		if ok != tt.ok || got > tt.want || got < tt.want-2*time.Second {
+			t.Errorf("retryAfter(%q) = %v, %v, want %v, %v", tt.value, got, ok, tt.want, tt.ok)
+		}
+	}
+}
+
+func TestRetryPolicy_backoff(t *testing.T) {
+	p := RetryPolicy{MaxAttempts: 5, MinBackoff: 100 * time.Millisecond, MaxBackoff: 300 * time.Millisecond}
+	resp := &http.Response{StatusCode: http.StatusBadGateway, Header: http.Header{}}
+	for attempt, max := range []time.Duration{100, 200, 300, 300} {
+		max *= time.Millisecond
+		wait, ok := p.backoff(context.Background(), attempt+1, resp, nil)
+		if !ok || wait < max/2 || wait > max {
+			t.Errorf("attempt %d: backoff = %v, %v, want between %v and %v", attempt+1, wait, ok, max/2, max)
+		}
+	}
+	if _, ok := p.backoff(context.Background(), 5, resp, nil); ok {
+		t.Error("expected no retry once MaxAttempts is reached")
+	}
+}
+
+func TestRefreshToken_retryAfterMaxBackoff(t *testing.T) {
+	ts, calls := newFlakyServer(t, http.Header{"Retry-After": {"60"}}, http.StatusTooManyRequests)
+	tr := newRetryTransport(t, ts)
+
+	start := time.Now()
+	_, err := tr.Token(context.Background())
+	var httpErr *HTTPError
+	if !errors.As(err, &httpErr) || httpErr.Response.StatusCode != http.StatusTooManyRequests {
+		t.Fatalf("Token error = %v, want *HTTPError for 429", err)
+	}
+	if elapsed := time.Since(start); elapsed > 500*time.Millisecond {
+		t.Errorf("Token took %v, want it to give up without waiting", elapsed)
+	}
+	if n := calls.Load(); n != 1 {
+		t.Errorf("requests = %d, want 1", n)
+	}
+}
+
+func TestRefreshToken_retryCanceled(t *testing.T) {
+	ts, calls := newFlakyServer(t, nil, http.StatusBadGateway)
+	tr := newRetryTransport(t, ts)
+	tr.Retry.MinBackoff, tr.Retry.MaxBackoff = time.Minute, time.Minute
+
+	ctx, cancel := context.WithCancel(context.Background())
+	time.AfterFunc(50*time.Millisecond, cancel)
+	_, err := tr.Token(ctx)
+	if !errors.Is(err, context.Canceled) {
+		t.Fatalf("Token error = %v, want context.Canceled", err)
+	}
+	var httpErr *HTTPError
+	if !errors.As(err, &httpErr) || httpErr.Attempts != 1 {
+		t.Errorf("Token error = %#v, want *HTTPError after 1 attempt", err)
+	}
+	if n := calls.Load(); n != 1 {
+		t.Errorf("requests = %d, want 1", n)
+	}
+}
+
+func TestRefreshToken_noRetryKeyError(t *testing.T) {
+	var fetches atomic.Int32
+	src := KeySourceFunc(func(context.Context) ([]byte, error) {
+		fetches.Add(1)
+		return nil, errors.New("vault sealed")
+	})
+	rt := &RoundTrip{rt: func(req *http.Request) (*http.Response, error) {
+		t.Error("request sent without a key")
+		return nil, errors.New("unexpected request")
+	}}
+	tr, err := NewFromKeySource(rt, appID, installationID, src)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tr.Retry = RetryPolicy{MinBackoff: time.Millisecond}
+
+	_, err = tr.Token(context.Background())
+	if err == nil || !strings.Contains(err.Error(), "vault sealed") {
+		t.Fatalf("Token error = %v, want the key source's error", err)
+	}
+	var httpErr *HTTPError
+	if errors.As(err, &httpErr) {
+		t.Errorf("Token error = %v, want no *HTTPError for a key error", err)
+	}
+	if n := fetches.Load(); n != 1 {
+		t.Errorf("key fetches = %d, want 1", n)
+	}
+}
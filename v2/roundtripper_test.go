@@ -0,0 +1,171 @@
+package ghinstallation
+
+import (
+	"errors"
+	"io"
+	"net/http"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+// trackedBody is a request body recording whether it was closed.
+type trackedBody struct {
+	io.Reader
+	closed bool
+}
+
+func (b *trackedBody) Close() error {
+	b.closed = true
+	return nil
+}
+
+// newContractTransports returns the RoundTrippers under test, sending
+// requests with rt.
+func newContractTransports(t *testing.T, rt http.RoundTripper) map[string]http.RoundTripper {
+	t.Helper()
+	itr, err := New(rt, appID, installationID, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	itr.token = &accessToken{Token: token, ExpiresAt: time.Now().Add(time.Hour)}
+	atr, err := NewAppsTransport(rt, appID, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return map[string]http.RoundTripper{"Transport": itr, "AppsTransport": atr}
+}
+
+// TestRoundTripperContract checks both transports follow the contract of
+// http.RoundTripper: the caller's request is not modified, and its body is
+// always closed.
+func TestRoundTripperContract(t *testing.T) {
+	var sent []*http.Request
+	rt := &RoundTrip{rt: func(req *http.Request) (*http.Response, error) {
+		sent = append(sent, req)
+		if req.Body != nil {
+			io.ReadAll(req.Body)
+			req.Body.Close()
+		}
+		return &http.Response{StatusCode: http.StatusOK, Body: http.NoBody, Request: req}, nil
+	}}
+
+	for name, tr := range newContractTransports(t, rt) {
+		t.Run(name, func(t *testing.T) {
+			sent = nil
+			body := &trackedBody{Reader: strings.NewReader("{}")}
+			req, err := http.NewRequest(http.MethodPost, "https://api.github.com/repos/o/r/issues", body)
+			if err != nil {
+				t.Fatal(err)
+			}
+			req.Header.Set("Accept", "application/vnd.github.raw+json")
+			req.Header.Set("X-Custom", "value")
+			want := req.Header.Clone()
+
+			for i := 0; i < 2; i++ {
+				resp, err := tr.RoundTrip(req)
+				if err != nil {
+					t.Fatalf("RoundTrip: %v", err)
+				}
+				if resp.StatusCode != http.StatusOK {
+					t.Errorf("StatusCode = %d, want 200", resp.StatusCode)
+				}
+				if !reflect.DeepEqual(req.Header, want) {
+					t.Errorf("caller's request headers modified: got %v, want %v", req.Header, want)
+				}
+			}
+			if !body.closed {
+				t.Error("request body not closed")
+			}
+
+			// Sending the same request again must not accumulate headers.
+			if len(sent) != 2 {
+				t.Fatalf("requests sent = %d, want 2", len(sent))
+			}
+			for i, r := range sent {
+				if r == req {
+					t.Errorf("request %d: caller's request sent rather than a copy", i)
+				}
+				accept := r.Header.Values("Accept")
+				if len(accept) != 1 || accept[0] != "application/vnd.github.raw+json" {
+					t.Errorf("request %d: Accept = %q, want only the caller's media type", i, accept)
+				}
+				if r.Header.Get("Authorization") == "" {
+					t.Errorf("request %d: no Authorization header", i)
+				}
+				if r.Header.Get("X-Custom") != "value" {
+					t.Errorf("request %d: X-Custom header lost", i)
+				}
+			}
+		})
+	}
+}
+
+// TestRoundTripperContract_error checks the request body is closed when
+// RoundTrip fails before sending the request.
+func TestRoundTripperContract_error(t *testing.T) {
+	rt := &RoundTrip{rt: func(req *http.Request) (*http.Response, error) {
+		if req.Body != nil {
+			req.Body.Close()
+		}
+		return nil, errors.New("network unreachable")
+	}}
+
+	itr, err := New(rt, appID, installationID, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	itr.Retry = RetryPolicy{MaxAttempts: 1}
+	atr, err := NewAppsTransport(rt, appID, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	atr.app = "invalid"
+
+	// The Transport fails to refresh its token, and the AppsTransport fails
+	// to sign its JWT, so neither sends the request.
+	for name, tr := range map[string]http.RoundTripper{"Transport": itr, "AppsTransport": atr} {
+		t.Run(name, func(t *testing.T) {
+			body := &trackedBody{Reader: strings.NewReader("{}")}
+			req, err := http.NewRequest(http.MethodPost, "https://api.github.com/repos/o/r/issues", body)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if _, err := tr.RoundTrip(req); err == nil {
+				t.Fatal("expected error")
+			}
+			if !body.closed {
+				t.Error("request body not closed on error")
+			}
+			if len(req.Header) != 0 {
+				t.Errorf("caller's request headers modified: %v", req.Header)
+			}
+		})
+	}
+}
+
+// TestRoundTripperContract_response checks responses are passed through
+// unmodified.
+func TestRoundTripperContract_response(t *testing.T) {
+	want := &http.Response{StatusCode: http.StatusTeapot, Header: http.Header{"X-Custom": {"value"}}, Body: io.NopCloser(strings.NewReader("body"))}
+	rt := &RoundTrip{rt: func(req *http.Request) (*http.Response, error) {
+		return want, nil
+	}}
+
+	for name, tr := range newContractTransports(t, rt) {
+		t.Run(name, func(t *testing.T) {
+			req, err := http.NewRequest(http.MethodGet, "https://api.github.com/app", nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			resp, err := tr.RoundTrip(req)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if resp != want {
+				t.Errorf("RoundTrip returned %+v, want the underlying response", resp)
+			}
+		})
+	}
+}
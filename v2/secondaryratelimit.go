@@ -0,0 +1,147 @@
+package ghinstallation
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+)
+
+const (
+	// defaultSecondaryRateLimitWait is how long to pause when GitHub does not
+	// advise a time, as GitHub recommends waiting at least a minute.
+	defaultSecondaryRateLimitWait = time.Minute
+	// defaultSecondaryRateLimitRetries is the default number of replays.
+	defaultSecondaryRateLimitRetries = 3
+	// maxSecondaryRateLimitBody bounds the response body read to detect
+	// secondary rate limits.
+	maxSecondaryRateLimitBody = 64 << 10
+)
+
+// SecondaryRateLimitPolicy configures how Transport handles GitHub's
+// secondary rate limits. The zero value passes secondary rate limit
+// responses through to the caller.
+//
+// When enabled, a secondary rate limit pauses all further requests for the
+// installation until the time advised by GitHub. Idempotent requests are
+// then replayed, while other requests fail with a *SecondaryRateLimitError.
+type SecondaryRateLimitPolicy struct {
+	Enabled    bool          // Enabled detects secondary rate limits and pauses requests
+	MaxWait    time.Duration // MaxWait is the longest a request is paused, requests which would wait longer fail, zero means no limit
+	MaxRetries int           // MaxRetries is the number of times an idempotent request is replayed, defaults to 3
+}
+
+// SecondaryRateLimitError is returned when a request is rejected by GitHub's
+// secondary rate limits and could not be replayed.
+type SecondaryRateLimitError struct {
+	InstallationID int64
+	Message        string         // Message is GitHub's error message
+	RetryAt        time.Time      // RetryAt is when GitHub advised requests may resume
+	Response       *http.Response // Response is the rate limited response, if any, with its body buffered in memory
+}
+
+func (e *SecondaryRateLimitError) Error() string {
+	return fmt.Sprintf("secondary rate limit exceeded for installation ID %v until %v: %s", e.InstallationID, e.RetryAt, e.Message)
+}
+
+// waitSecondaryRateLimit waits until any pause for the installation's
+// secondary rate limit has passed.
+func (t *Transport) waitSecondaryRateLimit(req *http.Request) error {
+	t.rateMu.Lock()
+	until := t.pausedUntil
+	t.rateMu.Unlock()
+
+	wait := time.Until(until)
+	if wait <= 0 {
+		return nil
+	}
+	if !t.secondaryRateLimitWaitAllowed(req, wait) {
+		return &SecondaryRateLimitError{
+			InstallationID: t.installationID,
+			Message:        "requests are paused for the installation",
+			RetryAt:        until,
+		}
+	}
+	if !sleep(req.Context(), wait) {
+		return req.Context().Err()
+	}
+	return nil
+}
+
+// secondaryRateLimitWaitAllowed reports whether req may wait for wait.
+func (t *Transport) secondaryRateLimitWaitAllowed(req *http.Request, wait time.Duration) bool {
+	if t.SecondaryRateLimitPolicy.MaxWait > 0 && wait > t.SecondaryRateLimitPolicy.MaxWait {
+		return false
+	}
+	if deadline, ok := req.Context().Deadline(); ok && time.Until(deadline) < wait {
+		return false
+	}
+	return true
+}
+
+// checkSecondaryRateLimit returns a *SecondaryRateLimitError if resp was
+// rejected by a secondary rate limit, pausing further requests until the
+// advised time. Otherwise nil is returned, leaving resp's body intact.
+func (t *Transport) checkSecondaryRateLimit(resp *http.Response) *SecondaryRateLimitError {
+	if resp.StatusCode != http.StatusForbidden && resp.StatusCode != http.StatusTooManyRequests {
+		return nil
+	}
+	// An exhausted primary rate limit is also reported with a 403 or 429.
+	if resp.Header.Get("X-RateLimit-Remaining") == "0" {
+		return nil
+	}
+
+	body, err := io.ReadAll(io.LimitReader(resp.Body, maxSecondaryRateLimitBody))
+	orig := resp.Body
+	resp.Body = struct {
+		io.Reader
+		io.Closer
+	}{io.MultiReader(bytes.NewReader(body), orig), orig}
+	if err != nil {
+		return nil
+	}
+	var apiErr struct {
+		Message string `json:"message"`
+	}
+	json.Unmarshal(body, &apiErr)
+
+	wait, hasRetryAfter := retryAfter(resp)
+	message := strings.ToLower(apiErr.Message)
+	if !hasRetryAfter && !strings.Contains(message, "secondary rate limit") && !strings.Contains(message, "abuse detection") {
+		return nil
+	}
+	if !hasRetryAfter {
+		wait = defaultSecondaryRateLimitWait
+	}
+
+	// The response is returned in an error, so the caller need not close it.
+	orig.Close()
+	resp.Body = io.NopCloser(bytes.NewReader(body))
+
+	until := time.Now().Add(wait)
+	t.rateMu.Lock()
+	if until.After(t.pausedUntil) {
+		t.pausedUntil = until
+	}
+	t.rateMu.Unlock()
+
+	return &SecondaryRateLimitError{
+		InstallationID: t.installationID,
+		Message:        apiErr.Message,
+		RetryAt:        until,
+		Response:       resp,
+	}
+}
+
+// isIdempotent reports whether req's method is idempotent and so req may be
+// safely replayed.
+func isIdempotent(req *http.Request) bool {
+	switch req.Method {
+	case "", http.MethodGet, http.MethodHead, http.MethodOptions, http.MethodPut, http.MethodDelete:
+		return true
+	}
+	return false
+}
@@ -0,0 +1,176 @@
+package ghinstallation
+
+import (
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+const secondaryRateLimitMessage = `{"message":"You have exceeded a secondary rate limit. Please wait a few minutes before you try again."}`
+
+// newSecondaryRateLimitServer returns a server serving installation tokens
+// and responding to other requests with responses in turn, then 200 OK.
+func newSecondaryRateLimitServer(t *testing.T, responses ...func(http.ResponseWriter)) (*httptest.Server, *atomic.Int32) {
+	var calls atomic.Int32
+	ts := newTokenServer(t, func(w http.ResponseWriter, r *http.Request) {
+		if n := int(calls.Add(1)); n <= len(responses) {
+			responses[n-1](w)
+			return
+		}
+		io.WriteString(w, "ok")
+	})
+	return ts, &calls
+}
+
+func secondaryRateLimited(status int, retryAfter string) func(http.ResponseWriter) {
+	return func(w http.ResponseWriter) {
+		if retryAfter != "" {
+			w.Header().Set("Retry-After", retryAfter)
+		}
+		w.WriteHeader(status)
+		io.WriteString(w, secondaryRateLimitMessage)
+	}
+}
+
+func newSecondaryRateLimitTransport(t *testing.T, ts *httptest.Server, policy SecondaryRateLimitPolicy) *Transport {
+	tr := newTestTransport(t, ts, installationID)
+	tr.SecondaryRateLimitPolicy = policy
+	return tr
+}
+
+func TestSecondaryRateLimit_replay(t *testing.T) {
+	ts, calls := newSecondaryRateLimitServer(t, secondaryRateLimited(http.StatusTooManyRequests, "0"))
+	tr := newSecondaryRateLimitTransport(t, ts, SecondaryRateLimitPolicy{Enabled: true})
+
+	resp, err := (&http.Client{Transport: tr}).Get(ts.URL + "/repos/o/r")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Errorf("StatusCode = %d, want 200", resp.StatusCode)
+	}
+	if n := calls.Load(); n != 2 {
+		t.Errorf("requests = %d, want 2", n)
+	}
+}
+
+func TestSecondaryRateLimit_nonIdempotent(t *testing.T) {
+	ts, calls := newSecondaryRateLimitServer(t, secondaryRateLimited(http.StatusForbidden, ""))
+	tr := newSecondaryRateLimitTransport(t, ts, SecondaryRateLimitPolicy{Enabled: true, MaxWait: time.Second})
+	client := &http.Client{Transport: tr}
+
+	_, err := client.Post(ts.URL+"/repos/o/r/issues", "application/json", strings.NewReader("{}"))
+	var rlErr *SecondaryRateLimitError
+	if !errors.As(err, &rlErr) {
+		t.Fatalf("error = %v, want *SecondaryRateLimitError", err)
+	}
+	if !strings.Contains(rlErr.Message, "secondary rate limit") {
+		t.Errorf("Message = %q, want GitHub's message", rlErr.Message)
+	}
+	if wait := time.Until(rlErr.RetryAt); wait < 50*time.Second {
+		t.Errorf("RetryAt in %v, want the default of a minute", wait)
+	}
+	if body, _ := io.ReadAll(rlErr.Response.Body); string(body) != secondaryRateLimitMessage {
+		t.Errorf("Response body = %q, want %q", body, secondaryRateLimitMessage)
+	}
+
+	// Further requests are paused, and fail as the pause exceeds MaxWait.
+	if _, err := client.Get(ts.URL + "/repos/o/r"); !errors.As(err, &rlErr) {
+		t.Fatalf("error = %v, want *SecondaryRateLimitError", err)
+	}
+	if n := calls.Load(); n != 1 {
+		t.Errorf("requests = %d, want 1", n)
+	}
+}
+
+func TestSecondaryRateLimit_pause(t *testing.T) {
+	ts, calls := newSecondaryRateLimitServer(t, secondaryRateLimited(http.StatusForbidden, "1"))
+	tr := newSecondaryRateLimitTransport(t, ts, SecondaryRateLimitPolicy{Enabled: true})
+
+	start := time.Now()
+	resp, err := (&http.Client{Transport: tr}).Get(ts.URL + "/repos/o/r")
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if elapsed := time.Since(start); elapsed < time.Second {
+		t.Errorf("replayed after %v, want Retry-After of 1s", elapsed)
+	}
+	if n := calls.Load(); n != 2 {
+		t.Errorf("requests = %d, want 2", n)
+	}
+}
+
+func TestSecondaryRateLimit_passThrough(t *testing.T) {
+	tests := []struct {
+		name     string
+		policy   SecondaryRateLimitPolicy
+		response func(http.ResponseWriter)
+	}{
+		{"disabled", SecondaryRateLimitPolicy{}, secondaryRateLimited(http.StatusForbidden, "0")},
+		{"primary", SecondaryRateLimitPolicy{Enabled: true}, func(w http.ResponseWriter) {
+			w.Header().Set("X-RateLimit-Remaining", "0")
+			w.WriteHeader(http.StatusForbidden)
+			io.WriteString(w, `{"message":"API rate limit exceeded"}`)
+		}},
+		{"forbidden", SecondaryRateLimitPolicy{Enabled: true}, func(w http.ResponseWriter) {
+			w.WriteHeader(http.StatusForbidden)
+			io.WriteString(w, `{"message":"Resource not accessible by integration"}`)
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ts, calls := newSecondaryRateLimitServer(t, tt.response)
+			tr := newSecondaryRateLimitTransport(t, ts, tt.policy)
+
+			resp, err := (&http.Client{Transport: tr}).Get(ts.URL + "/repos/o/r")
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer resp.Body.Close()
+			if resp.StatusCode != http.StatusForbidden {
+				t.Errorf("StatusCode = %d, want 403", resp.StatusCode)
+			}
+			if body, _ := io.ReadAll(resp.Body); !strings.Contains(string(body), "message") {
+				t.Errorf("body = %q, want it intact", body)
+			}
+			if n := calls.Load(); n != 1 {
+				t.Errorf("requests = %d, want 1", n)
+			}
+		})
+	}
+}
+
+func TestSecondaryRateLimit_sendError(t *testing.T) {
+	wantErr := errors.New("connection reset")
+	tr, err := New(RoundTrip{
+		rt: func(req *http.Request) (*http.Response, error) {
+			return nil, wantErr
+		},
+	}, appID, installationID, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tr.token = &accessToken{Token: token, ExpiresAt: time.Now().Add(time.Hour)}
+	tr.SecondaryRateLimitPolicy = SecondaryRateLimitPolicy{Enabled: true}
+
+	replay := &trackedBody{Reader: strings.NewReader("{}")}
+	req, err := http.NewRequest(http.MethodPut, "https://api.github.com/repos/o/r/topics", &trackedBody{Reader: strings.NewReader("{}")})
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.GetBody = func() (io.ReadCloser, error) { return replay, nil }
+
+	if _, err := tr.RoundTrip(req); !errors.Is(err, wantErr) {
+		t.Fatalf("error = %v, want %v", err, wantErr)
+	}
+	if !replay.closed {
+		t.Error("replay body was not closed")
+	}
+}
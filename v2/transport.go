@@ -7,7 +7,7 @@ import (
 	"fmt"
 	"io"
 	"net/http"
-	"os"
+	"strings"
 	"sync"
 	"time"
 
@@ -24,20 +24,35 @@ const (
 // installation.
 //
 // Client can also be overwritten, and is useful to change to one which
-// provides retry logic if you do experience retryable errors.
+// provides retry logic, a proxy or instrumentation for token refreshes. The
+// GitHub App's JWT is added to refresh requests before they are passed to
+// Client, so Client should not add its own authentication.
 //
 // See https://developer.github.com/apps/building-integrations/setting-up-and-registering-github-apps/about-authentication-options-for-github-apps/
 type Transport struct {
 	BaseURL                  string                           // BaseURL is the scheme and host for GitHub API, defaults to https://api.github.com
 	Client                   Client                           // Client to use to refresh tokens, defaults to http.Client with provided transport
 	tr                       http.RoundTripper                // tr is the underlying roundtripper being wrapped
-	appID                    string                           // appID is the GitHub App's ID
+	app                      AppIdentity                      // app is the GitHub App's ID or client ID
 	installationID           int64                            // installationID is the GitHub App Installation ID
 	InstallationTokenOptions *github.InstallationTokenOptions // parameters restrict a token's access
+	Retry                    RetryPolicy                      // Retry configures retries when refreshing tokens
+	RateLimitPolicy          RateLimitPolicy                  // RateLimitPolicy configures protection of the installation's rate limit budget
+	SecondaryRateLimitPolicy SecondaryRateLimitPolicy         // SecondaryRateLimitPolicy configures handling of secondary rate limits
+	Cache                    *Cache                           // Cache makes GET requests conditional on cached responses, optional
+	MediaType                string                           // MediaType is the Accept header sent when the request has none, defaults to application/vnd.github.v3+json
+	APIVersion               string                           // APIVersion is the X-GitHub-Api-Version header sent when the request has none, optional
+	AllowedHosts             []string                         // AllowedHosts are hosts, besides BaseURL's host and its uploads host, the token is sent to
+	RejectUnknownHosts       bool                             // RejectUnknownHosts fails requests to other hosts, instead of sending them without the token
 	appsTransport            *AppsTransport
 
 	mu    sync.Mutex   // mu protects token
 	token *accessToken // token is the installation's access token
+
+	rateMu      sync.Mutex           // rateMu protects rateLimits, inFlight and pausedUntil
+	rateLimits  map[string]RateLimit // rateLimits is the last budget per rate limit resource reported by GitHub
+	inFlight    map[string]int       // inFlight counts requests sent per rate limit resource without a response yet
+	pausedUntil time.Time            // pausedUntil is when requests may resume after a secondary rate limit
 }
 
 // accessToken is an installation access token response from GitHub
@@ -48,29 +63,62 @@ type accessToken struct {
 	Repositories []github.Repository            `json:"repositories,omitempty"`
 }
 
+// maxErrorBody bounds the response body read into an HTTPError.
+const maxErrorBody = 64 << 10
+
 // HTTPError represents a custom error for failing HTTP operations.
 // Example in our usecase: refresh access token operation.
 // It enables the caller to inspect the root cause and response.
 type HTTPError struct {
-	Message        string
-	RootCause      error
-	InstallationID int64
-	Response       *http.Response
+	Message          string
+	RootCause        error
+	InstallationID   int64
+	Response         *http.Response // Response is the failed response, if any, its body is a bounded copy and need not be closed
+	Attempts         int            // Attempts is the number of requests made, including retries
+	RequestID        string         // RequestID is the response's X-GitHub-Request-Id header, useful when contacting GitHub support
+	APIMessage       string         // APIMessage is the message of GitHub's error response
+	DocumentationURL string         // DocumentationURL is the documentation_url of GitHub's error response
+	Status           string         // Status is the status of GitHub's error response
 }
 
 func (e *HTTPError) Error() string {
 	return e.Message
 }
 
+// Unwrap returns the root cause, so errors.Is and errors.As match it.
+func (e *HTTPError) Unwrap() error {
+	return e.RootCause
+}
+
+// readResponse reads a bounded copy of resp's body, closing it, and decodes
+// GitHub's error response into e.
+func (e *HTTPError) readResponse(resp *http.Response) {
+	e.RequestID = resp.Header.Get("X-GitHub-Request-Id")
+	body, _ := io.ReadAll(io.LimitReader(resp.Body, maxErrorBody))
+	resp.Body.Close()
+	resp.Body = io.NopCloser(bytes.NewReader(body))
+
+	var apiErr struct {
+		Message          string `json:"message"`
+		DocumentationURL string `json:"documentation_url"`
+		Status           string `json:"status"`
+	}
+	if json.Unmarshal(body, &apiErr) == nil {
+		e.APIMessage, e.DocumentationURL, e.Status = apiErr.Message, apiErr.DocumentationURL, apiErr.Status
+	}
+}
+
 var _ http.RoundTripper = &Transport{}
 
-// NewKeyFromFile returns a Transport using a private key from file.
-func NewKeyFromFile(tr http.RoundTripper, appID string, installationID int64, privateKeyFile string) (*Transport, error) {
-	privateKey, err := os.ReadFile(privateKeyFile)
+// NewKeyFromFile returns a Transport using a private key from file, see
+// NewAppsTransportKeyFromFile for the checks applied to the file. appID is
+// the GitHub App's numeric app ID or client ID, see AppIdentity.
+func NewKeyFromFile(tr http.RoundTripper, appID string, installationID int64, privateKeyFile string, opts ...KeyFileOption) (*Transport, error) {
+	atr, err := NewAppsTransportKeyFromFile(tr, appID, privateKeyFile, opts...)
 	if err != nil {
-		return nil, fmt.Errorf("could not read private key: %s", err)
+		return nil, err
 	}
-	return New(tr, appID, installationID, privateKey)
+	return NewFromAppsTransport(atr, installationID), nil
 }
 
 // Client is a HTTP client which sends a http.Request and returns a http.Response
@@ -80,7 +128,8 @@ type Client interface {
 }
 
 // New returns an Transport using private key. The key is parsed
-// and if any errors occur the error is non-nil.
+// and if any errors occur the error is non-nil. appID is the GitHub App's
+// numeric app ID or client ID, see AppIdentity.
 //
 // The provided tr http.RoundTripper should be shared between multiple
 // installations to ensure reuse of underlying TCP connections.
@@ -95,33 +144,105 @@ func New(tr http.RoundTripper, appID string, installationID int64, privateKey []
 	return NewFromAppsTransport(atr, installationID), nil
 }
 
+// NewFromKeySource returns a Transport using the private key provided by src,
+// see NewAppsTransportFromKeySource.
+func NewFromKeySource(tr http.RoundTripper, app AppIdentity, installationID int64, src KeySource) (*Transport, error) {
+	atr, err := NewAppsTransportFromKeySource(tr, app, src)
+	if err != nil {
+		return nil, err
+	}
+	return NewFromAppsTransport(atr, installationID), nil
+}
+
 // NewFromAppsTransport returns a Transport using an existing *AppsTransport.
 func NewFromAppsTransport(atr *AppsTransport, installationID int64) *Transport {
 	return &Transport{
 		BaseURL:        atr.BaseURL,
 		Client:         &http.Client{Transport: atr.tr},
+		MediaType:      atr.MediaType,
+		APIVersion:     atr.APIVersion,
 		tr:             atr.tr,
-		appID:          atr.clientID,
+		app:            atr.app,
 		installationID: installationID,
 		appsTransport:  atr,
 	}
 }
 
 // RoundTrip implements http.RoundTripper interface.
+//
+// The installation token is only added to requests for BaseURL's host or its
+// uploads host over the same scheme, or for AllowedHosts over https or
+// BaseURL's scheme. Other requests are sent without the token, or fail with a
+// *HostNotAllowedError if RejectUnknownHosts is set.
+// Once a redirect chain leaves those hosts, the token is not added again,
+// see also CheckRedirect.
 func (t *Transport) RoundTrip(req *http.Request) (resp *http.Response, err error) {
+	if !t.tokenAllowed(req.URL) || t.leftAllowedHosts(req) {
+		return t.roundTripUnauthenticated(req)
+	}
 
 	token, err := t.Token(req.Context())
 	if err != nil {
+		closeRequestBody(req)
 		return nil, err
 	}
 
+	// A RoundTripper must not modify the caller's request, so add headers
+	// to a copy.
+	req = req.Clone(req.Context())
 	req.Header.Set("Authorization", "token "+token)
-	req.Header.Add("Accept", acceptHeader) // We add to "Accept" header to avoid overwriting existing req headers.
-	resp, err = t.tr.RoundTrip(req)
-	if err != nil {
-		return resp, err
+	setAPIHeaders(req, t.MediaType, t.APIVersion)
+
+	policy := t.SecondaryRateLimitPolicy
+	maxRetries := policy.MaxRetries
+	if maxRetries <= 0 {
+		maxRetries = defaultSecondaryRateLimitRetries
+	}
+	for attempt := 0; ; attempt++ {
+		if policy.Enabled {
+			if err := t.waitSecondaryRateLimit(req); err != nil {
+				closeRequestBody(req)
+				return nil, err
+			}
+		}
+		release, err := t.reserveRateLimit(req)
+		if err != nil {
+			closeRequestBody(req)
+			return nil, err
+		}
+
+		// Keep a copy of the request to replay, before the body is consumed.
+		var retry *http.Request
+		if policy.Enabled && isIdempotent(req) && attempt < maxRetries {
+			retry, _ = replayableRequest(req)
+		}
+
+		resp, err = t.send(req)
+		release(resp)
+		if err != nil {
+			if retry != nil {
+				closeRequestBody(retry)
+			}
+			return resp, err
+		}
+		if !policy.Enabled {
+			return resp, err
+		}
+
+		rlErr := t.checkSecondaryRateLimit(resp)
+		if rlErr == nil {
+			return resp, nil
+		}
+		if retry == nil || !t.secondaryRateLimitWaitAllowed(req, time.Until(rlErr.RetryAt)) {
+			if retry != nil {
+				closeRequestBody(retry)
+			}
+			return nil, rlErr
+		}
+		io.Copy(io.Discard, resp.Body)
+		resp.Body.Close()
+		req = retry
 	}
-	return resp, err
 }
 
 // Token checks the active token expiration and renews if necessary. Token returns
@@ -132,7 +253,7 @@ func (t *Transport) Token(ctx context.Context) (string, error) {
 	if t.token == nil || t.token.ExpiresAt.Add(-time.Minute).Before(time.Now()) {
 		// Token is not set or expired/nearly expired, so refresh
 		if err := t.refreshToken(ctx); err != nil {
-			return "", fmt.Errorf("could not refresh installation id %v's token: %w", t.installationID, err)
+			return "", fmt.Errorf("could not refresh installation id %v's token for %s: %w", t.installationID, t.app, err)
 		}
 	}
 
@@ -156,15 +277,84 @@ func (t *Transport) Repositories() ([]github.Repository, error) {
 }
 
 func (t *Transport) refreshToken(ctx context.Context) error {
+	if ctx == nil {
+		ctx = context.Background()
+	}
+
+	t.appsTransport.BaseURL = t.BaseURL
+	client := t.Client
+	if client == nil {
+		client = &http.Client{Transport: t.tr}
+	}
+	var resp *http.Response
+
+	for attempt := 1; ; attempt++ {
+		req, err := t.newTokenRequest(ctx)
+		if err != nil {
+			return err
+		}
+
+		// Only failures to reach GitHub are retried. Failures to fetch the
+		// key or sign the JWT would fail again, so they are returned as is.
+		var sent bool
+		resp, err = t.appsTransport.send(req, func(req *http.Request) (*http.Response, error) {
+			sent = true
+			return client.Do(req)
+		})
+		if err != nil && !sent {
+			return err
+		}
+		if wait, ok := t.Retry.backoff(ctx, attempt, resp, err); ok {
+			if resp != nil {
+				io.Copy(io.Discard, resp.Body)
+				resp.Body.Close()
+			}
+			if sleep(ctx, wait) {
+				continue
+			}
+			// The response has been discarded, so report the cancellation.
+			resp, err = nil, ctx.Err()
+		}
+
+		e := &HTTPError{
+			RootCause:      err,
+			InstallationID: t.installationID,
+			Response:       resp,
+			Attempts:       attempt,
+		}
+		if err != nil {
+			e.Message = fmt.Sprintf("could not get access_tokens from GitHub API for installation ID %v after %d attempt(s): %v", t.installationID, attempt, err)
+			return e
+		}
+		if resp.StatusCode/100 != 2 {
+			e.readResponse(resp)
+			e.Message = fmt.Sprintf("received non 2xx response status %q when fetching %v after %d attempt(s)", resp.Status, req.URL, attempt)
+			if e.APIMessage != "" {
+				e.Message += ": " + e.APIMessage
+			}
+			if e.RequestID != "" {
+				e.Message += fmt.Sprintf(" (request ID %s)", e.RequestID)
+			}
+			return e
+		}
+		break
+	}
+	defer resp.Body.Close()
+
+	return json.NewDecoder(resp.Body).Decode(&t.token)
+}
+
+// newTokenRequest returns a request for a new installation access token.
+func (t *Transport) newTokenRequest(ctx context.Context) (*http.Request, error) {
 	// Convert InstallationTokenOptions into a ReadWriter to pass as an argument to http.NewRequest.
 	body, err := GetReadWriter(t.InstallationTokenOptions)
 	if err != nil {
-		return fmt.Errorf("could not convert installation token parameters into json: %s", err)
+		return nil, fmt.Errorf("could not convert installation token parameters into json: %s", err)
 	}
 
-	req, err := http.NewRequest("POST", fmt.Sprintf("%s/app/installations/%v/access_tokens", t.BaseURL, t.installationID), body)
+	req, err := http.NewRequestWithContext(ctx, "POST", fmt.Sprintf("%s/app/installations/%v/access_tokens", strings.TrimSuffix(t.BaseURL, "/"), t.installationID), body)
 	if err != nil {
-		return fmt.Errorf("could not create request: %s", err)
+		return nil, fmt.Errorf("could not create request: %s", err)
 	}
 
 	// Set Content and Accept headers.
@@ -172,34 +362,10 @@ func (t *Transport) refreshToken(ctx context.Context) error {
 		req.Header.Set("Content-Type", "application/json")
 	}
 	req.Header.Set("Accept", acceptHeader)
-
-	if ctx != nil {
-		req = req.WithContext(ctx)
+	if t.APIVersion != "" {
+		req.Header.Set(apiVersionHeader, t.APIVersion)
 	}
-
-	t.appsTransport.BaseURL = t.BaseURL
-	t.appsTransport.Client = t.Client
-	var resp *http.Response
-
-	resp, err = t.appsTransport.RoundTrip(req)
-	e := &HTTPError{
-		RootCause:      err,
-		InstallationID: t.installationID,
-		Response:       resp,
-	}
-	if err != nil {
-		e.Message = fmt.Sprintf("could not get access_tokens from GitHub API for installation ID %v: %v", t.installationID, err)
-		return e
-	}
-
-	if resp.StatusCode/100 != 2 {
-		e.Message = fmt.Sprintf("received non 2xx response status %q when fetching %v", resp.Status, req.URL)
-		return e
-	}
-	// Closing body late, to provide caller a chance to inspect body in an error / non-200 response status situation
-	defer resp.Body.Close()
-
-	return json.NewDecoder(resp.Body).Decode(&t.token)
+	return req, nil
 }
 
 // GetReadWriter converts a body interface into an io.ReadWriter object.
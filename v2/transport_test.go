@@ -2,12 +2,15 @@ package ghinstallation
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io/ioutil"
 	"net/http"
 	"net/http/httptest"
 	"os"
+	"strings"
 	"testing"
 	"time"
 
@@ -17,7 +20,7 @@ import (
 
 const (
 	installationID = 1
-	appID          = "appID123"
+	appID          = "Iv1.0123456789abcdef"
 	token          = "abc123"
 )
 
@@ -246,3 +249,131 @@ func TestRefreshTokenWithParameters(t *testing.T) {
 		t.Fatalf("error calling RoundTrip: %v", err)
 	}
 }
+
+// writeToken responds to an installation token request with token.
+func writeToken(w http.ResponseWriter) {
+	fmt.Fprintf(w, `{"token":%q,"expires_at":%q}`, token, time.Now().Add(time.Hour).Format(time.RFC3339))
+}
+
+// newTokenServer returns a server serving installation tokens, and passing
+// other requests to handler.
+func newTokenServer(t *testing.T, handler http.HandlerFunc) *httptest.Server {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if strings.HasPrefix(r.URL.Path, "/app/installations/") && strings.HasSuffix(r.URL.Path, "/access_tokens") {
+			writeToken(w)
+			return
+		}
+		handler(w, r)
+	}))
+	t.Cleanup(ts.Close)
+	return ts
+}
+
+// newTestTransport returns a Transport for installationID using ts as the
+// GitHub API.
+func newTestTransport(t *testing.T, ts *httptest.Server, installationID int64) *Transport {
+	tr, err := New(ts.Client().Transport, appID, installationID, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tr.BaseURL = ts.URL
+	return tr
+}
+
+type clientFunc func(*http.Request) (*http.Response, error)
+
+func (f clientFunc) Do(req *http.Request) (*http.Response, error) {
+	return f(req)
+}
+
+func TestRefreshTokenWithClient(t *testing.T) {
+	var calls int
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !strings.HasPrefix(r.Header.Get("Authorization"), "Bearer ") {
+			t.Errorf("Authorization = %q, want a JWT", r.Header.Get("Authorization"))
+		}
+		fmt.Fprintf(w, `{"token":%q,"expires_at":%q}`, token, time.Now().Add(time.Hour).Format(time.RFC3339))
+	}))
+	defer ts.Close()
+
+	tr, err := New(&RoundTrip{rt: func(*http.Request) (*http.Response, error) {
+		t.Error("token refresh bypassed Client")
+		return nil, errors.New("unexpected request")
+	}}, appID, installationID, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tr.BaseURL = ts.URL
+	tr.Client = clientFunc(func(req *http.Request) (*http.Response, error) {
+		calls++
+		return ts.Client().Do(req)
+	})
+
+	got, err := tr.Token(context.Background())
+	if err != nil {
+		t.Fatalf("Token: %v", err)
+	}
+	if got != token {
+		t.Errorf("Token = %q, want %q", got, token)
+	}
+	if calls != 1 {
+		t.Errorf("Client calls = %d, want 1", calls)
+	}
+}
+
+func TestRefreshTokenHTTPError(t *testing.T) {
+	body := &trackedBody{Reader: strings.NewReader(`{"message":"A JSON web token could not be decoded","documentation_url":"https://docs.github.com/rest","status":"401"}`)}
+	rt := &RoundTrip{rt: func(req *http.Request) (*http.Response, error) {
+		return &http.Response{
+			Status:     "401 Unauthorized",
+			StatusCode: http.StatusUnauthorized,
+			Header:     http.Header{"X-Github-Request-Id": {"ABCD:1234"}},
+			Body:       body,
+		}, nil
+	}}
+	tr, err := New(rt, appID, installationID, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = tr.Token(context.Background())
+	var httpErr *HTTPError
+	if !errors.As(err, &httpErr) {
+		t.Fatalf("Token error = %v, want *HTTPError", err)
+	}
+	want := HTTPError{
+		RequestID:        "ABCD:1234",
+		APIMessage:       "A JSON web token could not be decoded",
+		DocumentationURL: "https://docs.github.com/rest",
+		Status:           "401",
+	}
+	if httpErr.RequestID != want.RequestID || httpErr.APIMessage != want.APIMessage ||
+		httpErr.DocumentationURL != want.DocumentationURL || httpErr.Status != want.Status {
+		t.Errorf("HTTPError = %+v, want %+v", httpErr, want)
+	}
+	if !strings.Contains(err.Error(), want.APIMessage) || !strings.Contains(err.Error(), want.RequestID) {
+		t.Errorf("Error() = %q, want GitHub's message and request ID", err.Error())
+	}
+	if !body.closed {
+		t.Error("response body not closed")
+	}
+	if got, _ := ioutil.ReadAll(httpErr.Response.Body); !strings.Contains(string(got), want.APIMessage) {
+		t.Errorf("Response body = %q, want a copy of the body", got)
+	}
+}
+
+func TestHTTPErrorUnwrap(t *testing.T) {
+	errNetwork := errors.New("connection refused")
+	rt := &RoundTrip{rt: func(req *http.Request) (*http.Response, error) {
+		return nil, errNetwork
+	}}
+	tr, err := New(rt, appID, installationID, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tr.Retry = RetryPolicy{MaxAttempts: 1}
+
+	if _, err := tr.Token(context.Background()); !errors.Is(err, errNetwork) {
+		t.Errorf("Token error = %v, want it to wrap the root cause", err)
+	}
+}
@@ -0,0 +1,304 @@
+// Package vaultsigner provides a crypto.Signer backed by an RSA key held in
+// HashiCorp Vault's Transit secrets engine, for use with
+// ghinstallation.NewAppsTransportFromSigner.
+package vaultsigner
+
+import (
+	"bytes"
+	"context"
+	"crypto"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pagerguild/ghinstallation/v2"
+)
+
+const (
+	// defaultMount is the path the Transit secrets engine is mounted at.
+	defaultMount = "transit"
+	// defaultAppRoleMount is the path the AppRole auth method is mounted at.
+	defaultAppRoleMount = "approle"
+	// defaultTimeout bounds calls to Sign, which has no context.
+	defaultTimeout = 10 * time.Second
+)
+
+// Config describes the Vault Transit key used to sign JWTs.
+type Config struct {
+	Address    string        // Address is the scheme and host of Vault, such as https://vault.example.com:8200
+	Namespace  string        // Namespace is the Vault Enterprise namespace, optional
+	Mount      string        // Mount is the path of the Transit secrets engine, defaults to transit
+	KeyName    string        // KeyName is the name of the Transit key
+	KeyVersion int           // KeyVersion is the key version to sign with, defaults to the latest version when New is called
+	Auth       Auth          // Auth authenticates to Vault
+	Client     *http.Client  // Client to use for Vault requests, defaults to http.DefaultClient
+	Timeout    time.Duration // Timeout bounds calls to Sign, which has no context, defaults to 10 seconds
+}
+
+// Auth authenticates requests to Vault, see TokenAuth and AppRoleAuth.
+type Auth interface {
+	// login returns a Vault token and its TTL, with a zero TTL if the
+	// token does not expire or need renewal.
+	login(ctx context.Context, s *Signer) (token string, ttl time.Duration, err error)
+}
+
+// TokenAuth authenticates to Vault with a static token.
+type TokenAuth struct {
+	Token string
+}
+
+func (a TokenAuth) login(context.Context, *Signer) (string, time.Duration, error) {
+	return a.Token, 0, nil
+}
+
+// AppRoleAuth authenticates to Vault using the AppRole auth method.
+type AppRoleAuth struct {
+	RoleID   string
+	SecretID string
+	Mount    string // Mount is the path of the AppRole auth method, defaults to approle
+}
+
+func (a AppRoleAuth) login(ctx context.Context, s *Signer) (string, time.Duration, error) {
+	mount := a.Mount
+	if mount == "" {
+		mount = defaultAppRoleMount
+	}
+	var resp struct {
+		Auth struct {
+			ClientToken   string `json:"client_token"`
+			LeaseDuration int    `json:"lease_duration"`
+		} `json:"auth"`
+	}
+	body := map[string]string{"role_id": a.RoleID, "secret_id": a.SecretID}
+	if err := s.do(ctx, http.MethodPost, "auth/"+mount+"/login", "", body, &resp); err != nil {
+		return "", 0, fmt.Errorf("could not login with AppRole: %w", err)
+	}
+	if resp.Auth.ClientToken == "" {
+		return "", 0, errors.New("could not login with AppRole: no client token in response")
+	}
+	return resp.Auth.ClientToken, time.Duration(resp.Auth.LeaseDuration) * time.Second, nil
+}
+
+// Error is returned when Vault responds with a non 2xx status.
+type Error struct {
+	StatusCode int
+	Errors     []string
+}
+
+func (e *Error) Error() string {
+	return fmt.Sprintf("vault responded with status %d: %s", e.StatusCode, strings.Join(e.Errors, "; "))
+}
+
+// Signer is a crypto.Signer which signs using an RSA key in Vault Transit.
+//
+// Signer implements ghinstallation.ContextSigner, so the context of the
+// request being authenticated is propagated to Vault.
+type Signer struct {
+	cfg Config
+	pub *rsa.PublicKey
+
+	mu      sync.Mutex // mu protects token and expires
+	token   string
+	expires time.Time
+}
+
+var _ ghinstallation.ContextSigner = &Signer{}
+
+// New authenticates to Vault and reads the public key of the Transit key,
+// which must be an RSA key.
+func New(ctx context.Context, cfg Config) (*Signer, error) {
+	if cfg.Address == "" || cfg.KeyName == "" || cfg.Auth == nil {
+		return nil, errors.New("vaultsigner: Address, KeyName and Auth are required")
+	}
+	if cfg.Mount == "" {
+		cfg.Mount = defaultMount
+	}
+	if cfg.Client == nil {
+		cfg.Client = http.DefaultClient
+	}
+	cfg.Address = strings.TrimSuffix(cfg.Address, "/")
+	s := &Signer{cfg: cfg}
+
+	var resp struct {
+		Data struct {
+			Type          string `json:"type"`
+			LatestVersion int    `json:"latest_version"`
+			Keys          map[string]struct {
+				PublicKey string `json:"public_key"`
+			} `json:"keys"`
+		} `json:"data"`
+	}
+	if err := s.authedDo(ctx, http.MethodGet, cfg.Mount+"/keys/"+url.PathEscape(cfg.KeyName), nil, &resp); err != nil {
+		return nil, fmt.Errorf("vaultsigner: could not read key %q: %w", cfg.KeyName, err)
+	}
+	if !strings.HasPrefix(resp.Data.Type, "rsa-") {
+		return nil, fmt.Errorf("vaultsigner: key %q has type %q, want an RSA key", cfg.KeyName, resp.Data.Type)
+	}
+	if s.cfg.KeyVersion == 0 {
+		s.cfg.KeyVersion = resp.Data.LatestVersion
+	}
+	version, ok := resp.Data.Keys[strconv.Itoa(s.cfg.KeyVersion)]
+	if !ok {
+		return nil, fmt.Errorf("vaultsigner: key %q has no version %d", cfg.KeyName, s.cfg.KeyVersion)
+	}
+	block, _ := pem.Decode([]byte(version.PublicKey))
+	if block == nil {
+		return nil, fmt.Errorf("vaultsigner: key %q version %d has no PEM public key", cfg.KeyName, s.cfg.KeyVersion)
+	}
+	pub, err := x509.ParsePKIXPublicKey(block.Bytes)
+	if err != nil {
+		return nil, fmt.Errorf("vaultsigner: could not parse public key: %w", err)
+	}
+	rsaPub, ok := pub.(*rsa.PublicKey)
+	if !ok {
+		return nil, fmt.Errorf("vaultsigner: key %q is %T, want *rsa.PublicKey", cfg.KeyName, pub)
+	}
+	s.pub = rsaPub
+	return s, nil
+}
+
+// Public implements crypto.Signer.
+func (s *Signer) Public() crypto.PublicKey {
+	return s.pub
+}
+
+// Sign implements crypto.Signer, see SignContext.
+func (s *Signer) Sign(_ io.Reader, digest []byte, opts crypto.SignerOpts) ([]byte, error) {
+	timeout := s.cfg.Timeout
+	if timeout <= 0 {
+		timeout = defaultTimeout
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	return s.SignContext(ctx, digest, opts)
+}
+
+// SignContext implements ghinstallation.ContextSigner. Only PKCS #1 v1.5
+// signatures of SHA-256 digests are supported, as required for RS256 JWTs.
+func (s *Signer) SignContext(ctx context.Context, digest []byte, opts crypto.SignerOpts) ([]byte, error) {
+	if opts.HashFunc() != crypto.SHA256 {
+		return nil, fmt.Errorf("vaultsigner: unsupported hash function %v", opts.HashFunc())
+	}
+	if _, ok := opts.(*rsa.PSSOptions); ok {
+		return nil, errors.New("vaultsigner: RSA-PSS signatures are not supported")
+	}
+
+	body := map[string]interface{}{
+		"input":               base64.StdEncoding.EncodeToString(digest),
+		"prehashed":           true,
+		"hash_algorithm":      "sha2-256",
+		"signature_algorithm": "pkcs1v15",
+		"key_version":         s.cfg.KeyVersion,
+	}
+	var resp struct {
+		Data struct {
+			Signature string `json:"signature"`
+		} `json:"data"`
+	}
+	if err := s.authedDo(ctx, http.MethodPost, s.cfg.Mount+"/sign/"+url.PathEscape(s.cfg.KeyName), body, &resp); err != nil {
+		return nil, fmt.Errorf("vaultsigner: could not sign with %q: %w", s.cfg.KeyName, err)
+	}
+
+	// Signatures are formatted as vault:v<version>:<base64 signature>.
+	parts := strings.SplitN(resp.Data.Signature, ":", 3)
+	if len(parts) != 3 || parts[0] != "vault" {
+		return nil, fmt.Errorf("vaultsigner: unexpected signature format %q", resp.Data.Signature)
+	}
+	sig, err := base64.StdEncoding.DecodeString(parts[2])
+	if err != nil {
+		return nil, fmt.Errorf("vaultsigner: could not decode signature: %w", err)
+	}
+	return sig, nil
+}
+
+// authedDo performs a request with a Vault token, logging in again if the
+// token is rejected.
+func (s *Signer) authedDo(ctx context.Context, method, path string, body, v interface{}) error {
+	token, err := s.getToken(ctx, false)
+	if err != nil {
+		return err
+	}
+	err = s.do(ctx, method, path, token, body, v)
+	var verr *Error
+	if errors.As(err, &verr) && verr.StatusCode == http.StatusForbidden {
+		if token, err = s.getToken(ctx, true); err != nil {
+			return err
+		}
+		err = s.do(ctx, method, path, token, body, v)
+	}
+	return err
+}
+
+// getToken returns the cached Vault token, logging in if there is no token,
+// it has expired or force is set.
+func (s *Signer) getToken(ctx context.Context, force bool) (string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if !force && s.token != "" && (s.expires.IsZero() || s.expires.After(time.Now())) {
+		return s.token, nil
+	}
+	token, ttl, err := s.cfg.Auth.login(ctx, s)
+	if err != nil {
+		return "", err
+	}
+	s.token, s.expires = token, time.Time{}
+	if ttl > 0 {
+		// Renew before the token expires to avoid it expiring in flight.
+		s.expires = time.Now().Add(ttl * 9 / 10)
+	}
+	return s.token, nil
+}
+
+// do performs a request against Vault's HTTP API, decoding the response into v.
+func (s *Signer) do(ctx context.Context, method, path, token string, body, v interface{}) error {
+	var r io.Reader
+	if body != nil {
+		b, err := json.Marshal(body)
+		if err != nil {
+			return err
+		}
+		r = bytes.NewReader(b)
+	}
+	req, err := http.NewRequestWithContext(ctx, method, s.cfg.Address+"/v1/"+path, r)
+	if err != nil {
+		return err
+	}
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	if token != "" {
+		req.Header.Set("X-Vault-Token", token)
+	}
+	if s.cfg.Namespace != "" {
+		req.Header.Set("X-Vault-Namespace", s.cfg.Namespace)
+	}
+
+	resp, err := s.cfg.Client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode/100 != 2 {
+		verr := &Error{StatusCode: resp.StatusCode}
+		var errResp struct {
+			Errors []string `json:"errors"`
+		}
+		if json.NewDecoder(io.LimitReader(resp.Body, 64<<10)).Decode(&errResp) == nil {
+			verr.Errors = errResp.Errors
+		}
+		return verr
+	}
+	return json.NewDecoder(resp.Body).Decode(v)
+}
@@ -0,0 +1,254 @@
+package vaultsigner
+
+import (
+	"bytes"
+	"context"
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/pagerguild/ghinstallation/v2"
+)
+
+const (
+	keyName  = "github-app"
+	roleID   = "role"
+	secretID = "secret"
+)
+
+// standIn is a local HTTP stand-in for the parts of Vault's API used by Signer.
+type standIn struct {
+	t    *testing.T
+	keys []*rsa.PrivateKey // keys are the Transit key's versions, starting at version 1
+
+	mu     sync.Mutex
+	tokens map[string]bool // tokens are the valid Vault tokens
+	logins int
+}
+
+func newStandIn(t *testing.T, versions int) (*standIn, *httptest.Server) {
+	v := &standIn{t: t, tokens: map[string]bool{"root": true}}
+	for i := 0; i < versions; i++ {
+		key, err := rsa.GenerateKey(rand.Reader, 2048)
+		if err != nil {
+			t.Fatal(err)
+		}
+		v.keys = append(v.keys, key)
+	}
+	ts := httptest.NewServer(v)
+	t.Cleanup(ts.Close)
+	return v, ts
+}
+
+// revoke invalidates all tokens, as if they had expired.
+func (v *standIn) revoke() {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	v.tokens = map[string]bool{}
+}
+
+func (v *standIn) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.URL.Path == "/v1/auth/approle/login" {
+		var in struct {
+			RoleID   string `json:"role_id"`
+			SecretID string `json:"secret_id"`
+		}
+		json.NewDecoder(r.Body).Decode(&in)
+		if in.RoleID != roleID || in.SecretID != secretID {
+			writeErrors(w, http.StatusBadRequest, "invalid role or secret ID")
+			return
+		}
+		v.mu.Lock()
+		v.logins++
+		token := fmt.Sprintf("approle-%d", v.logins)
+		v.tokens[token] = true
+		v.mu.Unlock()
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"auth": map[string]interface{}{"client_token": token, "lease_duration": 3600},
+		})
+		return
+	}
+
+	v.mu.Lock()
+	ok := v.tokens[r.Header.Get("X-Vault-Token")]
+	v.mu.Unlock()
+	if !ok {
+		writeErrors(w, http.StatusForbidden, "permission denied")
+		return
+	}
+
+	switch {
+	case r.Method == http.MethodGet && r.URL.Path == "/v1/transit/keys/"+keyName:
+		keys := map[string]interface{}{}
+		for i, key := range v.keys {
+			der, _ := x509.MarshalPKIXPublicKey(key.Public())
+			keys[fmt.Sprint(i+1)] = map[string]string{
+				"public_key": string(pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: der})),
+			}
+		}
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"data": map[string]interface{}{"type": "rsa-2048", "latest_version": len(v.keys), "keys": keys},
+		})
+	case r.Method == http.MethodPost && r.URL.Path == "/v1/transit/sign/"+keyName:
+		var in struct {
+			Input              string `json:"input"`
+			Prehashed          bool   `json:"prehashed"`
+			HashAlgorithm      string `json:"hash_algorithm"`
+			SignatureAlgorithm string `json:"signature_algorithm"`
+			KeyVersion         int    `json:"key_version"`
+		}
+		json.NewDecoder(r.Body).Decode(&in)
+		if !in.Prehashed || in.HashAlgorithm != "sha2-256" || in.SignatureAlgorithm != "pkcs1v15" {
+			writeErrors(w, http.StatusBadRequest, "unexpected signing parameters")
+			return
+		}
+		if in.KeyVersion < 1 || in.KeyVersion > len(v.keys) {
+			writeErrors(w, http.StatusBadRequest, "invalid key version")
+			return
+		}
+		digest, _ := base64.StdEncoding.DecodeString(in.Input)
+		sig, err := rsa.SignPKCS1v15(rand.Reader, v.keys[in.KeyVersion-1], crypto.SHA256, digest)
+		if err != nil {
+			writeErrors(w, http.StatusBadRequest, err.Error())
+			return
+		}
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"data": map[string]string{
+				"signature": fmt.Sprintf("vault:v%d:%s", in.KeyVersion, base64.StdEncoding.EncodeToString(sig)),
+			},
+		})
+	default:
+		writeErrors(w, http.StatusNotFound, "not found")
+	}
+}
+
+func writeErrors(w http.ResponseWriter, status int, errs ...string) {
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(map[string][]string{"errors": errs})
+}
+
+func sign(t *testing.T, s *Signer) ([]byte, []byte) {
+	digest := sha256.Sum256([]byte("message"))
+	sig, err := s.Sign(nil, digest[:], crypto.SHA256)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return digest[:], sig
+}
+
+func TestSigner_tokenAuth(t *testing.T) {
+	v, ts := newStandIn(t, 1)
+
+	s, err := New(context.Background(), Config{Address: ts.URL, KeyName: keyName, Auth: TokenAuth{Token: "root"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	digest, sig := sign(t, s)
+	if err := rsa.VerifyPKCS1v15(&v.keys[0].PublicKey, crypto.SHA256, digest, sig); err != nil {
+		t.Fatalf("VerifyPKCS1v15: %v", err)
+	}
+
+	if _, err := New(context.Background(), Config{Address: ts.URL, KeyName: keyName, Auth: TokenAuth{Token: "invalid"}}); err == nil {
+		t.Fatal("expected error with invalid token")
+	}
+}
+
+func TestSigner_appRoleAuth(t *testing.T) {
+	v, ts := newStandIn(t, 1)
+
+	s, err := New(context.Background(), Config{Address: ts.URL, KeyName: keyName, Auth: AppRoleAuth{RoleID: roleID, SecretID: secretID}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	sign(t, s)
+	if v.logins != 1 {
+		t.Errorf("logins = %d, want 1", v.logins)
+	}
+
+	// A rejected token causes a new login.
+	v.revoke()
+	digest, sig := sign(t, s)
+	if err := rsa.VerifyPKCS1v15(&v.keys[0].PublicKey, crypto.SHA256, digest, sig); err != nil {
+		t.Fatalf("VerifyPKCS1v15: %v", err)
+	}
+	if v.logins != 2 {
+		t.Errorf("logins = %d, want 2", v.logins)
+	}
+}
+
+func TestSigner_keyVersion(t *testing.T) {
+	v, ts := newStandIn(t, 3)
+
+	tests := []struct {
+		version int
+		want    *rsa.PrivateKey
+	}{
+		{version: 0, want: v.keys[2]}, // latest
+		{version: 1, want: v.keys[0]},
+		{version: 2, want: v.keys[1]},
+	}
+	for _, tt := range tests {
+		s, err := New(context.Background(), Config{Address: ts.URL, KeyName: keyName, KeyVersion: tt.version, Auth: TokenAuth{Token: "root"}})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !tt.want.PublicKey.Equal(s.Public()) {
+			t.Errorf("version %d: public key mismatch", tt.version)
+		}
+		digest, sig := sign(t, s)
+		if err := rsa.VerifyPKCS1v15(&tt.want.PublicKey, crypto.SHA256, digest, sig); err != nil {
+			t.Errorf("version %d: VerifyPKCS1v15: %v", tt.version, err)
+		}
+	}
+
+	if _, err := New(context.Background(), Config{Address: ts.URL, KeyName: keyName, KeyVersion: 4, Auth: TokenAuth{Token: "root"}}); err == nil {
+		t.Fatal("expected error for nonexistent key version")
+	}
+}
+
+func TestSigner_appsTransport(t *testing.T) {
+	v, ts := newStandIn(t, 1)
+
+	s, err := New(context.Background(), Config{Address: ts.URL, KeyName: keyName, Auth: TokenAuth{Token: "root"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	check := roundTripFunc(func(req *http.Request) (*http.Response, error) {
+		token := strings.Fields(req.Header.Get("Authorization"))[1]
+		_, err := jwt.NewParser(jwt.WithValidMethods([]string{"RS256"})).Parse(token, func(*jwt.Token) (interface{}, error) {
+			return v.keys[0].Public(), nil
+		})
+		if err != nil {
+			t.Errorf("jwt parse: %v", err)
+		}
+		return nil, nil
+	})
+
+	tr, err := ghinstallation.NewAppsTransportFromSigner(check, "Iv1.0123456789abcdef", s)
+	if err != nil {
+		t.Fatal(err)
+	}
+	req := httptest.NewRequest(http.MethodGet, "http://example.com", new(bytes.Buffer))
+	if _, err := tr.RoundTrip(req); err != nil {
+		t.Fatalf("error calling RoundTrip: %v", err)
+	}
+}
+
+type roundTripFunc func(*http.Request) (*http.Response, error)
+
+func (f roundTripFunc) RoundTrip(req *http.Request) (*http.Response, error) {
+	return f(req)
+}
@@ -0,0 +1,139 @@
+package ghinstallation
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/google/go-github/v69/github"
+)
+
+// maxClockSkew is the largest difference between the local clock and GitHub's
+// clock tolerated by the JWT's backdated issued at time.
+const maxClockSkew = 30 * time.Second
+
+// App is a GitHub App, as returned by Verify.
+type App struct {
+	github.App
+	ClientID string `json:"client_id,omitempty"`
+}
+
+// VerifyReason describes why Verify failed.
+type VerifyReason int
+
+const (
+	// VerifyReasonKey indicates GitHub rejected the JWT's signature, the
+	// private key does not belong to the app.
+	VerifyReasonKey VerifyReason = iota + 1
+	// VerifyReasonID indicates the app ID or client ID is unknown to GitHub,
+	// or does not match the app authenticated by the private key.
+	VerifyReasonID
+	// VerifyReasonClock indicates the local clock is skewed from GitHub's,
+	// so the JWT's issued at or expiry times were rejected.
+	VerifyReasonClock
+	// VerifyReasonUnknown indicates GitHub could not be reached, or
+	// responded unexpectedly.
+	VerifyReasonUnknown
+)
+
+func (r VerifyReason) String() string {
+	switch r {
+	case VerifyReasonKey:
+		return "key"
+	case VerifyReasonID:
+		return "id"
+	case VerifyReasonClock:
+		return "clock"
+	default:
+		return "unknown"
+	}
+}
+
+// VerifyError is returned by Verify when the AppsTransport could not
+// authenticate as the configured GitHub App.
+type VerifyError struct {
+	Reason    VerifyReason
+	Message   string
+	RootCause error
+	Response  *http.Response
+}
+
+func (e *VerifyError) Error() string {
+	return fmt.Sprintf("could not verify GitHub App (%s): %s", e.Reason, e.Message)
+}
+
+// Unwrap returns the root cause, if any.
+func (e *VerifyError) Unwrap() error {
+	return e.RootCause
+}
+
+// Verify checks the private key authenticates as the configured GitHub App
+// by calling GET /app, and returns the app's metadata. This allows a
+// misconfigured key or ID to be detected at startup, rather than when an
+// installation token is first refreshed.
+//
+// If verification fails, the error is a *VerifyError.
+func (t *AppsTransport) Verify(ctx context.Context) (*App, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, strings.TrimSuffix(t.BaseURL, "/")+"/app", nil)
+	if err != nil {
+		return nil, &VerifyError{Reason: VerifyReasonUnknown, Message: "could not create request", RootCause: err}
+	}
+
+	resp, err := t.RoundTrip(req)
+	if err != nil {
+		return nil, &VerifyError{Reason: VerifyReasonUnknown, Message: err.Error(), RootCause: err}
+	}
+	defer resp.Body.Close()
+	body, err := io.ReadAll(io.LimitReader(resp.Body, 1<<20))
+	if err != nil {
+		return nil, &VerifyError{Reason: VerifyReasonUnknown, Message: "could not read response", RootCause: err, Response: resp}
+	}
+
+	if resp.StatusCode/100 != 2 {
+		var ghErr struct {
+			Message string `json:"message"`
+		}
+		json.Unmarshal(body, &ghErr)
+		return nil, &VerifyError{
+			Reason:   verifyReason(resp, ghErr.Message),
+			Message:  fmt.Sprintf("received non 2xx response status %q: %s", resp.Status, ghErr.Message),
+			Response: resp,
+		}
+	}
+
+	var app App
+	if err := json.Unmarshal(body, &app); err != nil {
+		return nil, &VerifyError{Reason: VerifyReasonUnknown, Message: "could not decode app", RootCause: err, Response: resp}
+	}
+	if t.app != ClientID(app.ClientID) && t.app != AppID(app.GetID()) {
+		return nil, &VerifyError{
+			Reason:   VerifyReasonID,
+			Message:  fmt.Sprintf("key authenticated as %s (%s), want %s", AppID(app.GetID()), ClientID(app.ClientID), t.app),
+			Response: resp,
+		}
+	}
+	return &app, nil
+}
+
+// verifyReason determines the reason GitHub rejected the JWT.
+func verifyReason(resp *http.Response, message string) VerifyReason {
+	if date, err := http.ParseTime(resp.Header.Get("Date")); err == nil {
+		if skew := time.Since(date); skew > maxClockSkew || skew < -maxClockSkew {
+			return VerifyReasonClock
+		}
+	}
+	switch {
+	case strings.Contains(message, "('exp')"), strings.Contains(message, "('iat')"):
+		return VerifyReasonClock
+	case resp.StatusCode == http.StatusNotFound, strings.Contains(message, "Integration not found"):
+		return VerifyReasonID
+	case resp.StatusCode == http.StatusUnauthorized:
+		return VerifyReasonKey
+	default:
+		return VerifyReasonUnknown
+	}
+}
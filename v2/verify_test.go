@@ -0,0 +1,110 @@
+package ghinstallation
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// newAppServer returns a server which responds to GET /app as the app with
+// client ID appID, authenticated by the package's test key.
+func newAppServer(t *testing.T, clientID string, clock time.Time) *httptest.Server {
+	pub, err := jwt.ParseRSAPrivateKeyFromPEM(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/app" {
+			t.Errorf("unexpected path %q", r.URL.Path)
+		}
+		if !clock.IsZero() {
+			w.Header().Set("Date", clock.UTC().Format(http.TimeFormat))
+		}
+		w.Header().Set("Content-Type", "application/json")
+
+		token := strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")
+		claims := &jwt.RegisteredClaims{}
+		_, err := jwt.NewParser().ParseWithClaims(token, claims, func(*jwt.Token) (interface{}, error) {
+			return pub.Public(), nil
+		})
+		switch {
+		case err != nil:
+			w.WriteHeader(http.StatusUnauthorized)
+			fmt.Fprint(w, `{"message":"A JSON web token could not be decoded","documentation_url":"https://docs.github.com/rest"}`)
+		case !clock.IsZero() && claims.ExpiresAt.Before(clock):
+			w.WriteHeader(http.StatusUnauthorized)
+			fmt.Fprint(w, `{"message":"'Expiration time' claim ('exp') must be a numeric value representing the future time at which the assertion expires","documentation_url":"https://docs.github.com/rest"}`)
+		case claims.Issuer != clientID && claims.Issuer != "42":
+			w.WriteHeader(http.StatusUnauthorized)
+			fmt.Fprint(w, `{"message":"Integration not found","documentation_url":"https://docs.github.com/rest"}`)
+		default:
+			fmt.Fprintf(w, `{"id":42,"client_id":%q,"slug":"my-app","owner":{"login":"octo-org"},"permissions":{"contents":"read"},"events":["push"]}`, clientID)
+		}
+	}))
+	t.Cleanup(ts.Close)
+	return ts
+}
+
+func TestVerify(t *testing.T) {
+	for _, id := range []AppIdentity{appID, AppID(42)} {
+		ts := newAppServer(t, appID, time.Time{})
+		tr, err := NewAppsTransport(&http.Transport{}, string(id), key)
+		if err != nil {
+			t.Fatal(err)
+		}
+		tr.BaseURL = ts.URL
+
+		app, err := tr.Verify(context.Background())
+		if err != nil {
+			t.Fatalf("Verify with %q: %v", id, err)
+		}
+		if app.GetSlug() != "my-app" || app.GetOwner().GetLogin() != "octo-org" || app.ClientID != appID ||
+			app.GetPermissions().GetContents() != "read" || len(app.Events) != 1 {
+			t.Errorf("unexpected app metadata: %+v", app)
+		}
+	}
+}
+
+func TestVerify_errors(t *testing.T) {
+	_, otherPEM := generateKeyPEM(t)
+
+	tests := []struct {
+		name     string
+		clientID string
+		key      []byte
+		server   string // server is the client ID known to the server
+		clock    time.Time
+		want     VerifyReason
+	}{
+		{name: "wrong key", clientID: appID, key: otherPEM, server: appID, want: VerifyReasonKey},
+		{name: "unknown ID", clientID: "Iv1.fedcba9876543210", key: key, server: appID, want: VerifyReasonID},
+		{name: "mismatched ID", clientID: appID, key: key, server: "Iv1.other", want: VerifyReasonID},
+		{name: "clock skew", clientID: appID, key: key, server: appID, clock: time.Now().Add(10 * time.Minute), want: VerifyReasonClock},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ts := newAppServer(t, tt.server, tt.clock)
+			tr, err := NewAppsTransport(&http.Transport{}, tt.clientID, tt.key)
+			if err != nil {
+				t.Fatal(err)
+			}
+			tr.BaseURL = ts.URL
+
+			_, err = tr.Verify(context.Background())
+			var verr *VerifyError
+			if !errors.As(err, &verr) {
+				t.Fatalf("Verify error = %v, want *VerifyError", err)
+			}
+			if verr.Reason != tt.want {
+				t.Errorf("Reason = %v, want %v (%v)", verr.Reason, tt.want, verr)
+			}
+		})
+	}
+}